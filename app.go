@@ -1,6 +1,8 @@
 package freedom
 
 import (
+	"context"
+
 	"github.com/8treenet/freedom/internal"
 	"github.com/8treenet/iris/v12"
 	"github.com/8treenet/iris/v12/core/host"
@@ -21,6 +23,12 @@ func initApp() {
 type Application interface {
 	// Install the database. A function that returns the Interface type is passed in as a handle to the database.
 	InstallDB(f func() (db interface{}))
+	// Install a database under a name. Repositories get it by FetchNamedDB.
+	InstallNamedDB(name string, f func() (db interface{}))
+	// Install a read replica of the database. The reads of FetchDB and FetchReadDB go to the replicas.
+	InstallReplicaDB(f func() (db interface{}))
+	// Install a read replica of the database installed under name.
+	InstallNamedReplicaDB(name string, f func() (db interface{}))
 	// Install the redis. A function that returns the redis.Cmdable is passed in as a handle to the client.
 	InstallRedis(f func() (client redis.Cmdable))
 	// Install a custom data source. A function that returns the Interface type is passed in as a handle to the custom data sources.
@@ -49,6 +57,8 @@ type Application interface {
 	BindBooting(f func(bootManager BootManager))
 	// Install the middleware for the message bus.
 	InstallBusMiddleware(handle ...BusHandler)
+	// Install the leader elector, the leader only jobs and hooks run on the leader.
+	InstallLeaderElector(elector LeaderElector)
 	InstallSerializer(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error)
 }
 
@@ -67,6 +77,17 @@ func Prometheus() *internal.Prometheus {
 	return app.Prometheus
 }
 
+// Health Checks the installed components and returns the aggregated report.
+func Health(ctx context.Context) HealthReport {
+	return app.Health(ctx)
+}
+
+// IsLeader Reports whether this instance runs the leader only work.
+// Without a leader elector every instance is the leader.
+func IsLeader() bool {
+	return app.IsLeader()
+}
+
 // ServiceLocator Return serviceLocator.
 // Use the service locator to get the service.
 func ServiceLocator() *internal.ServiceLocatorImpl {
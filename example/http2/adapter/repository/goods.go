@@ -5,6 +5,7 @@ import (
 
 	"github.com/8treenet/freedom"
 	"github.com/8treenet/freedom/example/http2/domain/vo"
+	"github.com/8treenet/freedom/infra/requests"
 	"gorm.io/gorm"
 )
 
@@ -29,13 +30,12 @@ func (repo *GoodsRepository) GetGoods(goodsID int) (result vo.Goods) {
 	addr := "http://127.0.0.1:8000/goods/" + strconv.Itoa(goodsID)
 	repo.NewH2CRequest(addr).Get().ToJSON(&result)
 
-	//开启go 并发,并且没有group wait。请求结束触发相关对象回收，会快于当前并发go的读取数据，所以使用DeferRecycle
-	repo.Worker().DeferRecycle()
-	go func() {
+	//开启go 并发,并且没有group wait。Go 使用独立的后台 Worker, 不受请求结束回收的影响，程序关闭时会等待后台 Worker
+	freedom.Go(repo.Worker(), func(work freedom.Worker) {
 		var model vo.Goods
-		repo.NewH2CRequest(addr).Get().ToJSON(&model)
-		repo.NewHTTPRequest(addr, false).Get().ToJSON(&model)
-	}()
+		requests.NewH2CRequest(addr).WithContext(work.Context()).SetHeader(work.Bus().Header).Get().ToJSON(&model)
+		requests.NewHTTPRequest(addr).WithContext(work.Context()).Get().ToJSON(&model)
+	})
 	return result
 }
 
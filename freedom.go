@@ -1,6 +1,9 @@
 package freedom
 
 import (
+	"context"
+	"time"
+
 	"github.com/8treenet/freedom/internal"
 	"github.com/8treenet/iris/v12/hero"
 	"github.com/8treenet/iris/v12/mvc"
@@ -17,6 +20,50 @@ func init() {
 const (
 	//TransactionKey for transaction DB handles in the first-level cache
 	TransactionKey = internal.TransactionKey
+	//FencingTokenKey for the fencing token of the leader only jobs in the first-level cache
+	FencingTokenKey = internal.FencingTokenKey
+)
+
+const (
+	// DeadlineHeader The header that carries the remaining budget of the request in milliseconds.
+	DeadlineHeader = internal.DeadlineHeader
+	// TraceparentHeader The header of the W3C Trace Context.
+	TraceparentHeader = internal.TraceparentHeader
+	// EventIDHeader The header that carries the identity of the event in a message.
+	EventIDHeader = internal.EventIDHeader
+	// TracestateHeader The vendor specific header of the W3C Trace Context.
+	TracestateHeader = internal.TracestateHeader
+	// BaggageHeader The header of the W3C Baggage.
+	BaggageHeader = internal.BaggageHeader
+)
+
+const (
+	// OnStart Runs after the singletons are booted and before the server listens.
+	OnStart = internal.OnStart
+	// OnReady Runs once the server is listening.
+	OnReady = internal.OnReady
+	// OnDrain Runs first when the application shuts down, stop consuming and producing work.
+	OnDrain = internal.OnDrain
+	// OnStop Runs after the server has stopped, close the connections.
+	OnStop = internal.OnStop
+)
+
+const (
+	// EventSequential Processes the messages of a partition one after the other.
+	EventSequential = internal.EventSequential
+	// EventConcurrent Processes the messages concurrently.
+	EventConcurrent = internal.EventConcurrent
+	// EventKeyOrdered Processes the messages of a key in order and the keys concurrently.
+	EventKeyOrdered = internal.EventKeyOrdered
+)
+
+const (
+	// PerRequest The object is pooled and used by one request at a time, it is the default.
+	PerRequest = internal.PerRequest
+	// Singleton One object is shared by all the requests, it must not have a Worker field.
+	Singleton = internal.Singleton
+	// Transient A new object is created for every request and it is never reused.
+	Transient = internal.Transient
 )
 
 type (
@@ -61,6 +108,9 @@ type (
 	// Bus Message bus, using http header to pass through data.
 	Bus = internal.Bus
 
+	// TraceContext The W3C traceparent of a request.
+	TraceContext = internal.TraceContext
+
 	// BusHandler is the bus message middleware type.
 	BusHandler = internal.BusHandler
 
@@ -83,6 +133,33 @@ type (
 	LogRow = golog.Log
 
 	Handler = iris.Handler
+
+	// HealthChecker is implemented by the components that report their health to the readiness endpoint.
+	HealthChecker = internal.HealthChecker
+
+	// HealthReport is the aggregated health status of the application.
+	HealthReport = internal.HealthReport
+
+	// HealthComponent is the health status of a component.
+	HealthComponent = internal.HealthComponent
+
+	// LifecyclePhase is the phase of the application in which a hook runs.
+	LifecyclePhase = internal.LifecyclePhase
+
+	// LifecycleHook is a function that runs in a phase of the application.
+	LifecycleHook = internal.LifecycleHook
+
+	// Lifetime is the lifetime of the services, repositories and factories.
+	Lifetime = internal.Lifetime
+
+	// EventMode is the mode to process the messages of an event.
+	EventMode = internal.EventMode
+
+	// JobConfig The options of a job bound by BindJob.
+	JobConfig = internal.JobConfig
+
+	// LeaderElector Elects one instance of the service as the leader.
+	LeaderElector = internal.LeaderElector
 )
 
 // Prepare A prepared function is passed in for initialization.
@@ -90,6 +167,64 @@ func Prepare(f func(Initiator)) {
 	internal.Prepare(f)
 }
 
+// NamedTransactionKey Returns the key of the transaction DB handle for the named data source.
+func NamedTransactionKey(name string) string {
+	return internal.NamedTransactionKey(name)
+}
+
+// FetchNamedDB Gets the database handle installed under name for the worker, in its transaction if there is one.
+// The default database is named "".
+func FetchNamedDB(worker Worker, name string, db interface{}) error {
+	return internal.FetchNamedDB(worker, name, db)
+}
+
+// ParseDeadline Returns the deadline of the budget in value, which was sent at start.
+func ParseDeadline(value string, start time.Time) (time.Time, bool) {
+	return internal.ParseDeadline(value, start)
+}
+
+// DeadlineBudget Returns the value of DeadlineHeader for the deadline of ctx.
+func DeadlineBudget(ctx context.Context) (string, bool) {
+	return internal.DeadlineBudget(ctx)
+}
+
+// NewTraceContext Returns a sampled trace context with a new trace id.
+func NewTraceContext() TraceContext {
+	return internal.NewTraceContext()
+}
+
+// NewTraceContextWithID Returns a sampled trace context of the trace id.
+func NewTraceContextWithID(traceID string) TraceContext {
+	return internal.NewTraceContextWithID(traceID)
+}
+
+// ParseTraceparent Parses the value of the traceparent header.
+func ParseTraceparent(value string) (TraceContext, bool) {
+	return internal.ParseTraceparent(value)
+}
+
+// Detach Returns a background Worker for the work that outlives the request of worker.
+// Its context is canceled when the application has shut down.
+func Detach(worker Worker) Worker {
+	return internal.Detach(worker)
+}
+
+// Recycle Ends a Worker marked by DeferRecycle, the shutdown waits for the Worker until it is called.
+func Recycle(worker Worker) {
+	internal.Recycle(worker)
+}
+
+// SetEventPrototypes Sets the prototypes of the events from the Bus of the worker,
+// the events that have prototypes are kept as they are.
+func SetEventPrototypes(worker Worker, events ...DomainEvent) {
+	internal.SetEventPrototypes(worker, events...)
+}
+
+// Go Runs f in a goroutine with a Worker detached from worker, the shutdown waits for f.
+func Go(worker Worker, f func(Worker)) {
+	internal.Go(worker, f)
+}
+
 // NewUnitTest Unit testing tools.
 func NewUnitTest() UnitTest {
 	return internal.NewUnitTest()
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// GraphFormat .
+	GraphFormat = "json"
+	// GraphCmd .
+	GraphCmd = &cobra.Command{
+		Use:   "graph [main package]",
+		Short: "Print the dependency graph of the project.",
+		Long:  `Print the resolved graph of controllers, services, factories, repositories and infras as JSON or DOT, the main package defaults to "."`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			mainPackage := "."
+			if len(args) > 0 {
+				mainPackage = args[0]
+			}
+
+			//The application prints the graph instead of serving when FREEDOM_GRAPH is set.
+			run := exec.Command("go", "run", mainPackage)
+			run.Env = append(os.Environ(), "FREEDOM_GRAPH="+GraphFormat)
+			run.Stdout = os.Stdout
+			run.Stderr = os.Stderr
+			return run.Run()
+		},
+	}
+)
+
+func init() {
+	GraphCmd.Flags().StringVarP(&GraphFormat, "format", "f", "json", `The format of the graph, "json" or "dot"`)
+
+	AddCommand(GraphCmd)
+}
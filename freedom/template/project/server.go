@@ -44,6 +44,15 @@ prometheus_listen_addr = ":9090"
 logger_level = "debug"
 # shutdown_second : Elegant lying off for the longest time
 shutdown_second = 3	
+# drain_second : After the shutdown begins, the time to wait for the load balancer to notice the readiness
+drain_second = 0
+# stop_second : The longest time of the OnStop hooks after the server stops
+stop_second = 5
+# recycle_second : The longest time to wait for the DeferRecycle workers after the server stops
+recycle_second = 3
+# liveness_path, readiness_path : The probes, the readiness aggregates the health of the components
+liveness_path = "/healthz"
+readiness_path = "/readyz"
 `
 }
 
@@ -71,6 +80,11 @@ other:
     prometheus_listen_addr: :9090
     logger_level: debug
     shutdown_second: 3
+    drain_second: 0
+    stop_second: 5
+    recycle_second: 3
+    liveness_path: /healthz
+    readiness_path: /readyz
 `
 }
 
@@ -0,0 +1,52 @@
+package freedom
+
+import "github.com/8treenet/freedom/internal"
+
+// ServiceOf Returns the service of type T for the worker.
+//
+//	svc, err := freedom.ServiceOf[*domain.GoodsService](worker)
+func ServiceOf[T any](worker Worker) (T, error) {
+	return internal.ServiceOf[T](worker)
+}
+
+// InfraOf Returns the infra of type T for the worker, T can be an interface implemented by a bound infra.
+func InfraOf[T any](worker Worker) (T, error) {
+	return internal.InfraOf[T](worker)
+}
+
+// SingleInfraOf Returns the singleton infra of type T.
+func SingleInfraOf[T any]() (T, error) {
+	return internal.SingleInfraOf[T]()
+}
+
+// CustomOf Returns the custom data source of type T installed by InstallCustom.
+func CustomOf[T any]() (T, error) {
+	return internal.CustomOf[T]()
+}
+
+// RepositoryOf Returns the repository of type T for the unit test.
+func RepositoryOf[T any](test UnitTest) (T, error) {
+	return internal.RepositoryOf[T](test)
+}
+
+// FactoryOf Returns the factory of type T for the unit test.
+func FactoryOf[T any](test UnitTest) (T, error) {
+	return internal.FactoryOf[T](test)
+}
+
+// BindService Binds a function that creates the service of type *T.
+//
+//	freedom.BindService(initiator, func() *GoodsService { return &GoodsService{} })
+func BindService[T any](initiator Initiator, f func() *T, lifetime ...Lifetime) {
+	internal.BindService(initiator, f, lifetime...)
+}
+
+// BindRepository Binds a function that creates the repository of type *T.
+func BindRepository[T any](initiator Initiator, f func() *T, lifetime ...Lifetime) {
+	internal.BindRepository(initiator, f, lifetime...)
+}
+
+// BindFactory Binds a function that creates the factory of type *T.
+func BindFactory[T any](initiator Initiator, f func() *T, lifetime ...Lifetime) {
+	internal.BindFactory(initiator, f, lifetime...)
+}
@@ -0,0 +1,222 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/8treenet/freedom"
+	"github.com/8treenet/freedom/infra/transaction"
+)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindInfra(true, dispatcher)
+	})
+}
+
+var dispatcher = &Dispatcher{subscribers: make(map[string][]*subscriber)}
+
+// GetDispatcher Gets the domain event dispatcher.
+func GetDispatcher() *Dispatcher {
+	return dispatcher
+}
+
+var (
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+	domainEventType = reflect.TypeOf((*freedom.DomainEvent)(nil)).Elem()
+)
+
+// subscriber is a handler subscribed to a topic.
+type subscriber struct {
+	name      string
+	fun       reflect.Value
+	eventType reflect.Type
+	async     bool
+}
+
+// Dispatcher The in-process dispatcher of the domain events, no broker is required.
+// The handlers subscribe by DomainEvent.Topic() and run with a Worker like
+// ServiceLocator().Call, the prototypes of the event are the Bus of the Worker.
+type Dispatcher struct {
+	freedom.Infra
+	subscribers map[string][]*subscriber
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	draining    bool
+}
+
+// errDraining is returned for the asynchronous handlers of the events published during the drain.
+var errDraining = errors.New("the dispatcher is draining, the asynchronous handler is not run")
+
+// Booting The method of overriding the component .
+// The single-case component initiates a callback.
+func (d *Dispatcher) Booting(bootManager freedom.BootManager) {
+	if len(d.subscribers) == 0 {
+		return
+	}
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "dispatcher",
+		Phase: freedom.OnDrain,
+		Func:  d.wait,
+	})
+}
+
+// Subscribe Subscribes the handler to the events of the topic. The handler is a
+// func(*Service, *Event) error, the event is decoded with Unmarshal if it is not
+// of the type *Event. The handler runs in the goroutine of the publisher unless
+// async is true, the asynchronous handlers share the event and must not modify it.
+func (d *Dispatcher) Subscribe(topic string, handler interface{}, async ...bool) {
+	ftype := reflect.TypeOf(handler)
+	if ftype == nil || ftype.Kind() != reflect.Func || ftype.NumIn() != 2 || ftype.In(0).Kind() != reflect.Ptr ||
+		!validEventType(ftype.In(1)) || ftype.NumOut() != 1 || ftype.Out(0) != errorType {
+		panic(fmt.Sprintf("[Freedom] The handler of the event '%s' must be a func(*Service, *Event) error", topic))
+	}
+	sub := &subscriber{
+		name:      runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name(),
+		fun:       reflect.ValueOf(handler),
+		eventType: ftype.In(1),
+		async:     len(async) > 0 && async[0],
+	}
+	d.subscribers[topic] = append(d.subscribers[topic], sub)
+}
+
+// WorkerGetter Gets the Worker of the request, the repositories and the infras are WorkerGetters.
+type WorkerGetter interface {
+	Worker() freedom.Worker
+}
+
+// Save Delivers the pub events of the entity after the transaction of the
+// repository commits, or now without a transaction. The events are removed
+// from the entity and their prototypes are set from the Bus of the Worker.
+// The errors of the synchronous handlers are logged, they cannot roll back the
+// committed transaction.
+func (d *Dispatcher) Save(repo WorkerGetter, entity freedom.Entity) {
+	events := entity.GetPubEvents()
+	entity.RemoveAllPubEvent()
+	if len(events) == 0 {
+		return
+	}
+
+	worker := repo.Worker()
+	freedom.SetEventPrototypes(worker, events...)
+	transaction.AfterCommit(worker, func() {
+		if err := d.Publish(worker.Context(), events...); err != nil {
+			freedom.Logger().Errorf("[Freedom] Failed to deliver the committed events, error:%v", err)
+		}
+	})
+}
+
+// Publish Delivers the events now, it returns the errors of the synchronous handlers.
+// The asynchronous handlers are rejected with an error once the application drains.
+func (d *Dispatcher) Publish(ctx context.Context, events ...freedom.DomainEvent) error {
+	var errs []error
+	for _, event := range events {
+		for _, sub := range d.subscribers[event.Topic()] {
+			if !sub.async {
+				errs = append(errs, d.deliver(ctx, sub, event))
+				continue
+			}
+
+			if !d.add() {
+				errs = append(errs, fmt.Errorf("topic:%s, id:%s, handler:%s: %w", event.Topic(), event.Identity(), sub.name, errDraining))
+				continue
+			}
+			go func(sub *subscriber, event freedom.DomainEvent) {
+				defer d.wg.Done()
+				d.deliver(context.WithoutCancel(ctx), sub, event)
+			}(sub, event)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// add counts an asynchronous handler, it is false once the dispatcher drains.
+// The handlers are counted under the lock, none is added while wait waits.
+func (d *Dispatcher) add() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.wg.Add(1)
+	return true
+}
+
+// wait rejects the new asynchronous handlers and waits for the running ones.
+func (d *Dispatcher) wait(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the event handlers did not finish: %w", ctx.Err())
+	}
+}
+
+// deliver calls the handler with a Worker, a panic is returned as an error.
+func (d *Dispatcher) deliver(ctx context.Context, sub *subscriber, event freedom.DomainEvent) (e error) {
+	defer func() {
+		if perr := recover(); perr != nil {
+			e = fmt.Errorf("panic: %v", perr)
+		}
+		if e != nil {
+			freedom.Logger().Errorf("[Freedom] The event handler failed, topic:%s, id:%s, handler:%s, error:%v", event.Topic(), event.Identity(), sub.name, e)
+		}
+	}()
+
+	eventValue, err := convertEvent(event, sub.eventType)
+	if err != nil {
+		return err
+	}
+	header := make(http.Header)
+	for key, value := range event.GetPrototypes() {
+		header.Set(key, fmt.Sprint(value))
+	}
+	header.Set(freedom.EventIDHeader, event.Identity())
+
+	ftype := reflect.FuncOf([]reflect.Type{sub.fun.Type().In(0)}, []reflect.Type{errorType}, false)
+	fun := reflect.MakeFunc(ftype, func(args []reflect.Value) []reflect.Value {
+		return sub.fun.Call([]reflect.Value{args[0], eventValue})
+	})
+	return freedom.ServiceLocator().CallContext(ctx, fun.Interface(), header)
+}
+
+// validEventType reports whether t is freedom.DomainEvent or a pointer that implements it.
+func validEventType(t reflect.Type) bool {
+	if t == domainEventType {
+		return true
+	}
+	return t.Kind() == reflect.Ptr && t.Implements(domainEventType)
+}
+
+// convertEvent returns the event as t, the event is decoded into a new t if it is of another type.
+func convertEvent(event freedom.DomainEvent, t reflect.Type) (reflect.Value, error) {
+	if reflect.TypeOf(event).AssignableTo(t) {
+		return reflect.ValueOf(event), nil
+	}
+	content, err := event.Marshal()
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	result := reflect.New(t.Elem())
+	target := result.Interface().(freedom.DomainEvent)
+	if err := target.Unmarshal(content); err != nil {
+		return reflect.Value{}, fmt.Errorf("failed to decode the event into %v: %w", t, err)
+	}
+	target.SetIdentity(event.Identity())
+	target.SetPrototypes(event.GetPrototypes())
+	return result, nil
+}
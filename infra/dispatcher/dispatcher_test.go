@@ -0,0 +1,85 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/8treenet/freedom"
+)
+
+type testEvent struct {
+	ID         string                 `json:"-"`
+	Prototypes map[string]interface{} `json:"-"`
+	OrderID    int                    `json:"orderId"`
+}
+
+func (e *testEvent) Topic() string                          { return "order-paid" }
+func (e *testEvent) SetPrototypes(m map[string]interface{}) { e.Prototypes = m }
+func (e *testEvent) GetPrototypes() map[string]interface{}  { return e.Prototypes }
+func (e *testEvent) Marshal() ([]byte, error)               { return json.Marshal(e) }
+func (e *testEvent) Unmarshal(data []byte) error            { return json.Unmarshal(data, e) }
+func (e *testEvent) Identity() string                       { return e.ID }
+func (e *testEvent) SetIdentity(identity string)            { e.ID = identity }
+
+type rawEvent struct {
+	testEvent
+}
+
+type testService struct{}
+
+func TestDispatcherSubscribe(t *testing.T) {
+	d := &Dispatcher{subscribers: make(map[string][]*subscriber)}
+	d.Subscribe("order-paid", func(*testService, *testEvent) error { return nil })
+	d.Subscribe("order-paid", func(*testService, freedom.DomainEvent) error { return nil }, true)
+	if len(d.subscribers["order-paid"]) != 2 || !d.subscribers["order-paid"][1].async {
+		t.Fatalf("subscribers = %v", d.subscribers)
+	}
+
+	for _, handler := range []interface{}{
+		nil,
+		func(*testService) error { return nil },
+		func(*testService, testEvent) error { return nil },
+		func(*testService, *testEvent) {},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("the handler %T is accepted", handler)
+				}
+			}()
+			d.Subscribe("bad", handler)
+		}()
+	}
+}
+
+func TestDispatcherDrain(t *testing.T) {
+	d := &Dispatcher{subscribers: make(map[string][]*subscriber)}
+	d.Subscribe("order-paid", func(*testService, *testEvent) error { return nil }, true)
+	if err := d.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Publish(context.Background(), &testEvent{ID: "1"}); !errors.Is(err, errDraining) {
+		t.Fatalf("the asynchronous handler must be rejected during the drain, error:%v", err)
+	}
+}
+
+func TestConvertEvent(t *testing.T) {
+	event := &rawEvent{testEvent{ID: "1", OrderID: 7, Prototypes: map[string]interface{}{"x-request-id": "abc"}}}
+
+	value, err := convertEvent(event, domainEventType)
+	if err != nil || value.Interface() != event {
+		t.Fatalf("convertEvent() = %v, %v, want the same event", value, err)
+	}
+
+	value, err = convertEvent(event, reflect.TypeOf(&testEvent{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := value.Interface().(*testEvent)
+	if decoded.OrderID != 7 || decoded.ID != "1" || decoded.Prototypes["x-request-id"] != "abc" {
+		t.Fatalf("decoded = %+v", decoded)
+	}
+}
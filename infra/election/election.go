@@ -0,0 +1,253 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindInfra(true, elector)
+	})
+}
+
+var elector = new(RedisElector)
+
+// GetElector Gets the leader elector.
+func GetElector() *RedisElector {
+	return elector
+}
+
+// Config The configuration of the leader election.
+type Config struct {
+	// Key of the lease in redis, the instances of a service use the same key.
+	Key string
+	// TTL of the lease, 15s by default. A leader that cannot renew the lease
+	// steps down when the lease expires.
+	TTL time.Duration
+	// RenewInterval is the interval to renew the lease or to campaign, TTL/3 by default.
+	RenewInterval time.Duration
+}
+
+// Install Enables the leader election, the lease is kept in the installed redis.
+func Install(conf Config) {
+	if conf.TTL <= 0 {
+		conf.TTL = 15 * time.Second
+	}
+	if conf.RenewInterval <= 0 || conf.RenewInterval >= conf.TTL {
+		conf.RenewInterval = conf.TTL / 3
+	}
+	elector.conf = conf
+}
+
+// The value of the lease is "id:token", the token counter never expires.
+var (
+	acquireScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], ARGV[1] .. ':' .. token, 'PX', ARGV[2])
+return token`)
+
+	renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+	resignScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// RedisElector The leader election with a lease in redis.
+// The leader renews the lease, the other instances campaign when it expires.
+// Every lease has a fencing token that increases with every new leader.
+type RedisElector struct {
+	freedom.Infra
+	conf   Config
+	id     string
+	client redis.Cmdable
+
+	mu         sync.Mutex
+	token      int64
+	leaseUntil time.Time
+	watchers   []func(leader bool)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Booting The method of overriding the component .
+// The single-case component initiates a callback.
+func (e *RedisElector) Booting(bootManager freedom.BootManager) {
+	if e.conf.Key == "" {
+		return
+	}
+	if e.client = e.Redis(); e.client == nil {
+		panic("[Freedom] The leader election requires the redis, please install")
+	}
+	hostname, _ := os.Hostname()
+	e.id = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), strings.ReplaceAll(uuid.New().String(), "-", "")[:8])
+	bootManager.InstallLeaderElector(e)
+
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "leader-election",
+		Phase: freedom.OnStart,
+		Func: func(ctx context.Context) error {
+			e.campaign(ctx)
+			e.start()
+			return nil
+		},
+	})
+	//The leader only jobs stop first, the lease is released for the other instances
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "leader-election",
+		Phase: freedom.OnDrain,
+		Func:  e.resign,
+	})
+}
+
+// IsLeader Reports whether this instance holds the lease.
+func (e *RedisElector) IsLeader() bool {
+	_, ok := e.FencingToken()
+	return ok
+}
+
+// FencingToken Returns the token of the lease held by this instance.
+func (e *RedisElector) FencingToken() (int64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token == 0 || !time.Now().Before(e.leaseUntil) {
+		return 0, false
+	}
+	return e.token, true
+}
+
+// Watch Calls f when this instance becomes the leader or loses the leadership.
+// A leader that cannot renew the lease loses the leadership once the lease has
+// expired, f is called at most RenewInterval later.
+func (e *RedisElector) Watch(f func(leader bool)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.watchers = append(e.watchers, f)
+}
+
+// notify calls the watchers, it is called without the lock.
+func (e *RedisElector) notify(leader bool) {
+	e.mu.Lock()
+	watchers := e.watchers
+	e.mu.Unlock()
+	for _, f := range watchers {
+		f(leader)
+	}
+}
+
+func (e *RedisElector) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.conf.RenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.campaign(ctx)
+			}
+		}
+	}()
+}
+
+// campaign renews the lease of the leader, the other instances try to acquire it.
+func (e *RedisElector) campaign(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.conf.RenewInterval)
+	defer cancel()
+
+	e.mu.Lock()
+	token := e.token
+	e.mu.Unlock()
+	//The lease is counted from before the call, it expires locally before it does in redis
+	start := time.Now()
+	ttl := strconv.FormatInt(e.conf.TTL.Milliseconds(), 10)
+
+	if token != 0 {
+		renewed, err := renewScript.Run(ctx, e.client, []string{e.conf.Key}, e.value(token), ttl).Int64()
+		if err != nil {
+			freedom.Logger().Errorf("[Freedom] Failed to renew the leader lease, key:%s, error:%v", e.conf.Key, err)
+		}
+		e.mu.Lock()
+		switch {
+		case err == nil && renewed == 1:
+			e.leaseUntil = start.Add(e.conf.TTL)
+			e.mu.Unlock()
+			return
+		case err != nil && time.Now().Before(e.leaseUntil):
+			e.mu.Unlock()
+			return
+		}
+		e.token = 0
+		e.mu.Unlock()
+		freedom.Logger().Infof("[Freedom] This instance lost the leadership, key:%s, token:%d", e.conf.Key, token)
+		e.notify(false)
+		return
+	}
+
+	token, err := acquireScript.Run(ctx, e.client, []string{e.conf.Key, e.conf.Key + ":token"}, e.id, ttl).Int64()
+	if err != nil {
+		freedom.Logger().Errorf("[Freedom] Failed to campaign for the leadership, key:%s, error:%v", e.conf.Key, err)
+		return
+	}
+	if token == 0 {
+		return
+	}
+	e.mu.Lock()
+	e.token = token
+	e.leaseUntil = start.Add(e.conf.TTL)
+	e.mu.Unlock()
+	freedom.Logger().Infof("[Freedom] This instance is the leader, key:%s, token:%d", e.conf.Key, token)
+	e.notify(true)
+}
+
+// resign stops the campaign and releases the lease if this instance holds it.
+func (e *RedisElector) resign(ctx context.Context) error {
+	if e.cancel == nil {
+		return nil
+	}
+	e.cancel()
+	<-e.done
+
+	e.mu.Lock()
+	token := e.token
+	e.token = 0
+	e.mu.Unlock()
+	if token == 0 {
+		return nil
+	}
+	e.notify(false)
+	err := resignScript.Run(ctx, e.client, []string{e.conf.Key}, e.value(token)).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	return nil
+}
+
+func (e *RedisElector) value(token int64) string {
+	return e.id + ":" + strconv.FormatInt(token, 10)
+}
@@ -0,0 +1,94 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testRedis returns the local redis, or an in-process miniredis without it.
+// The clock of miniredis follows the wall clock so that the keys expire.
+func testRedis(t *testing.T) redis.Cmdable {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", MaxRetries: -1, DialerRetries: 1})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		server := miniredis.RunT(t)
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					server.FastForward(10 * time.Millisecond)
+				}
+			}
+		}()
+		t.Cleanup(func() {
+			close(done)
+		})
+		client = redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	}
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return client
+}
+
+func newTestElector(client redis.Cmdable, key, id string) (*RedisElector, chan bool) {
+	e := &RedisElector{conf: Config{Key: key, TTL: time.Second, RenewInterval: 300 * time.Millisecond}, id: id, client: client}
+	changes := make(chan bool, 4)
+	e.Watch(func(leader bool) {
+		changes <- leader
+	})
+	return e, changes
+}
+
+func TestElection(t *testing.T) {
+	client := testRedis(t)
+	ctx := context.Background()
+	key := fmt.Sprintf("election:test:%d", time.Now().UnixNano())
+	defer client.Del(ctx, key, key+":token")
+
+	first, firstChanges := newTestElector(client, key, "first")
+	second, secondChanges := newTestElector(client, key, "second")
+
+	first.campaign(ctx)
+	second.campaign(ctx)
+	firstToken, ok := first.FencingToken()
+	if !ok || second.IsLeader() || !<-firstChanges {
+		t.Fatal("only one instance must acquire the lease")
+	}
+
+	//The lease is renewed beyond its first expiry
+	time.Sleep(600 * time.Millisecond)
+	first.campaign(ctx)
+	time.Sleep(600 * time.Millisecond)
+	second.campaign(ctx)
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatal("the leader must renew the lease")
+	}
+
+	first.start()
+	if err := first.resign(ctx); err != nil || first.IsLeader() || <-firstChanges {
+		t.Fatal("the leader must release the lease", err)
+	}
+	second.campaign(ctx)
+	secondToken, ok := second.FencingToken()
+	if !ok || secondToken <= firstToken || !<-secondChanges {
+		t.Fatal("the new leader must have a greater fencing token", firstToken, secondToken)
+	}
+
+	//Another instance took the lease, the renewal fails
+	client.Set(ctx, key, "third:100", time.Second)
+	second.campaign(ctx)
+	if second.IsLeader() || <-secondChanges {
+		t.Fatal("the leader must step down when the lease is lost")
+	}
+}
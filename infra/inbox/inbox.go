@@ -0,0 +1,356 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/8treenet/freedom/infra/transaction"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The backends of the inbox.
+const (
+	// DB records the events in a table, in the transaction of the handler if there is one.
+	// Without a transaction the event is leased while the handler runs.
+	DB = "db"
+	// Redis records the events in the installed redis after the transaction commits.
+	Redis = "redis"
+)
+
+// ErrInProgress The event is being processed by another handler, the message should be retried.
+var ErrInProgress = errors.New("inbox: the event is in progress")
+
+// Config The configuration of the inbox.
+type Config struct {
+	// Backend is DB or Redis, DB by default.
+	Backend string
+	// Table of the records, "freedom_inbox" by default. It is migrated when the application boots.
+	Table string
+	// DataSource is the name of the installed database, the default database by default.
+	DataSource string
+	// Retention of the records, 7 days by default. A duplicate that arrives later is processed again.
+	Retention time.Duration
+	// Lease of an event in progress, 1m by default. It is used by the Redis backend
+	// and by the DB backend without a transaction, an event of a crashed handler
+	// is processed again after the lease.
+	Lease time.Duration
+}
+
+var conf = Config{}
+
+// Install Enables the inbox.
+func Install(c Config) {
+	if c.Backend == "" {
+		c.Backend = DB
+	}
+	if c.Backend != DB && c.Backend != Redis {
+		panic(fmt.Sprintf("[Freedom] Unknown inbox backend '%s'", c.Backend))
+	}
+	if c.Table == "" {
+		c.Table = "freedom_inbox"
+	}
+	if c.Retention <= 0 {
+		c.Retention = 7 * 24 * time.Hour
+	}
+	if c.Lease <= 0 {
+		c.Lease = time.Minute
+	}
+	conf = c
+	pruner.installed = true
+}
+
+// The status of a record.
+const (
+	StatusDone       = 1
+	StatusProcessing = 2
+)
+
+// Record The row of a processed event.
+type Record struct {
+	ID       uint64    `gorm:"primaryKey;autoIncrement"`
+	Identity string    `gorm:"size:191;uniqueIndex;not null"`
+	Status   int       `gorm:"not null;default:1"`
+	Expires  time.Time `gorm:"not null"`
+	Created  time.Time `gorm:"index;not null"`
+}
+
+// Inbox The idempotent inbox of the consumed events.
+type Inbox interface {
+	// Process Runs fun once for the id, a duplicate returns nil without running fun.
+	// A duplicate of an event in progress returns ErrInProgress.
+	// The id is the freedom.EventIDHeader of the consumed message if it is empty.
+	Process(id string, fun func() error) error
+	// ProcessEvent Runs fun once for the identity of the event.
+	ProcessEvent(event freedom.DomainEvent, fun func() error) error
+}
+
+var _ Inbox = (*InboxImpl)(nil)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindInfra(false, func() *InboxImpl {
+			return &InboxImpl{}
+		})
+		initiator.BindInfra(true, pruner)
+	})
+}
+
+// InboxImpl .
+type InboxImpl struct {
+	freedom.Infra
+}
+
+// BeginRequest Polymorphic method, subclasses can override overrides overrides.
+// The request is triggered after entry.
+func (inbox *InboxImpl) BeginRequest(worker freedom.Worker) {
+	inbox.Infra.BeginRequest(worker)
+}
+
+// ProcessEvent Runs fun once for the identity of the event.
+func (inbox *InboxImpl) ProcessEvent(event freedom.DomainEvent, fun func() error) error {
+	return inbox.Process(event.Identity(), fun)
+}
+
+// Process Runs fun once for the id, a duplicate returns nil without running fun.
+// The id is the freedom.EventIDHeader of the consumed message if it is empty, the
+// header is set by the producers of the outbox and the dispatcher.
+// Several handlers of the same event should prefix the id with their name.
+func (inbox *InboxImpl) Process(id string, fun func() error) error {
+	if !pruner.installed {
+		return errors.New("[Freedom] The inbox is not installed")
+	}
+	if id == "" {
+		id = inbox.Worker().Bus().Get(freedom.EventIDHeader)
+	}
+	if id == "" {
+		return errors.New("[Freedom] The inbox requires the id of the event")
+	}
+	if conf.Backend == Redis {
+		return inbox.processRedis(id, fun)
+	}
+	return inbox.processDB(id, fun)
+}
+
+// processDB records the event before fun runs. In a transaction the record is
+// committed with the changes of fun, a concurrent duplicate waits on the unique
+// index until the first transaction ends and skips the committed event.
+// Without a transaction the event is leased while fun runs, a concurrent
+// duplicate returns ErrInProgress, and the record is deleted if fun fails.
+func (inbox *InboxImpl) processDB(id string, fun func() error) error {
+	db, inTx, err := inbox.db()
+	if err != nil {
+		return err
+	}
+	if inTx {
+		now := time.Now()
+		result := db.Table(conf.Table).Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&Record{Identity: id, Status: StatusDone, Expires: now, Created: now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			inbox.Worker().Logger().Infof("[Freedom] Skip the duplicate event, id:%s", id)
+			return nil
+		}
+		return fun()
+	}
+
+	if err := inbox.lease(db, id); err != nil {
+		if errors.Is(err, errDuplicate) {
+			inbox.Worker().Logger().Infof("[Freedom] Skip the duplicate event, id:%s", id)
+			return nil
+		}
+		return err
+	}
+	//The record is kept if the result cannot be written, the event is processed again after the lease
+	ctx := context.WithoutCancel(inbox.Worker().Context())
+	if err := fun(); err != nil {
+		if derr := db.WithContext(ctx).Table(conf.Table).Where("identity = ? AND status = ?", id, StatusProcessing).Delete(&Record{}).Error; derr != nil {
+			inbox.Worker().Logger().Errorf("[Freedom] Failed to release the event in the inbox, id:%s, error:%v", id, derr)
+		}
+		return err
+	}
+	if err := db.WithContext(ctx).Table(conf.Table).Where("identity = ?", id).Update("status", StatusDone).Error; err != nil {
+		inbox.Worker().Logger().Errorf("[Freedom] Failed to record the event in the inbox, id:%s, error:%v", id, err)
+	}
+	return nil
+}
+
+// errDuplicate is returned by lease for a processed event.
+var errDuplicate = errors.New("inbox: the event is processed")
+
+// lease records the event in progress. The lease of an event in progress is
+// taken over when it has expired, the handler that held it has crashed.
+func (inbox *InboxImpl) lease(db *gorm.DB, id string) error {
+	now := time.Now()
+	result := db.Table(conf.Table).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Record{Identity: id, Status: StatusProcessing, Expires: now.Add(conf.Lease), Created: now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	var record Record
+	if err := db.Table(conf.Table).Where("identity = ?", id).Take(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			//The first handler failed and released the event
+			return ErrInProgress
+		}
+		return err
+	}
+	if record.Status != StatusProcessing {
+		return errDuplicate
+	}
+	if record.Expires.After(now) {
+		return ErrInProgress
+	}
+	result = db.Table(conf.Table).Where("identity = ? AND status = ? AND expires = ?", id, StatusProcessing, record.Expires).
+		Updates(map[string]interface{}{"expires": now.Add(conf.Lease), "created": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInProgress
+	}
+	inbox.Worker().Logger().Infof("[Freedom] Take over the expired event in the inbox, id:%s", id)
+	return nil
+}
+
+// processRedis leases the event while fun runs, the event is recorded after the
+// transaction commits.
+func (inbox *InboxImpl) processRedis(id string, fun func() error) error {
+	client := inbox.Redis()
+	if client == nil {
+		return errors.New("[Freedom] The inbox requires the redis, please install")
+	}
+	ctx := context.WithoutCancel(inbox.Worker().Context())
+	key := "inbox:" + id
+	ok, err := client.SetNX(ctx, key, "processing", conf.Lease).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		status, err := client.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if status == "done" {
+			inbox.Worker().Logger().Infof("[Freedom] Skip the duplicate event, id:%s", id)
+			return nil
+		}
+		return ErrInProgress
+	}
+
+	//A failed event is released, the lease of a rolled back transaction expires
+	if err := fun(); err != nil {
+		client.Del(ctx, key)
+		return err
+	}
+	transaction.AfterCommit(inbox.Worker(), func() {
+		if err := client.Set(ctx, key, "done", conf.Retention).Err(); err != nil {
+			inbox.Worker().Logger().Errorf("[Freedom] Failed to record the event in the inbox, id:%s, error:%v", id, err)
+		}
+	}, conf.DataSource)
+	return nil
+}
+
+// db returns the DB of the transaction if there is one.
+func (inbox *InboxImpl) db() (*gorm.DB, bool, error) {
+	if tx, ok := inbox.Worker().Store().Get(freedom.NamedTransactionKey(conf.DataSource)).(*gorm.DB); ok {
+		return tx, true, nil
+	}
+	var db *gorm.DB
+	if err := inbox.FetchOnlyNamedDB(conf.DataSource, &db); err != nil {
+		return nil, false, err
+	}
+	return db.WithContext(inbox.Worker().Context()), false, nil
+}
+
+var pruner = new(inboxPruner)
+
+// inboxPruner migrates the table of the DB backend and deletes the expired records.
+type inboxPruner struct {
+	freedom.Infra
+	installed bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// Booting The method of overriding the component .
+// The single-case component initiates a callback.
+func (p *inboxPruner) Booting(bootManager freedom.BootManager) {
+	if !p.installed || conf.Backend != DB {
+		return
+	}
+	db := p.db()
+	if err := db.Table(conf.Table).AutoMigrate(&Record{}); err != nil {
+		panic(fmt.Sprintf("[Freedom] Failed to migrate the inbox, %v", err))
+	}
+
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "inbox",
+		Phase: freedom.OnReady,
+		Func: func(ctx context.Context) error {
+			ctx, p.cancel = context.WithCancel(context.Background())
+			p.done = make(chan struct{})
+			go p.loop(ctx)
+			return nil
+		},
+	})
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "inbox",
+		Phase: freedom.OnDrain,
+		Func: func(ctx context.Context) error {
+			p.cancel()
+			<-p.done
+			return nil
+		},
+	})
+}
+
+func (p *inboxPruner) db() *gorm.DB {
+	var db *gorm.DB
+	if err := p.FetchOnlyNamedDB(conf.DataSource, &db); err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func (p *inboxPruner) loop(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := p.prune(ctx); err != nil && ctx.Err() == nil {
+			freedom.Logger().Errorf("[Freedom] Failed to prune the inbox, error:%v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes the records older than the retention.
+func (p *inboxPruner) prune(ctx context.Context) error {
+	for ctx.Err() == nil {
+		var ids []uint64
+		err := p.db().WithContext(ctx).Table(conf.Table).Where("created < ?", time.Now().Add(-conf.Retention)).
+			Order("id ASC").Limit(1000).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := p.db().WithContext(ctx).Table(conf.Table).Where("id IN ?", ids).Delete(&Record{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package inbox
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/8treenet/freedom/infra/transaction"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testRepository struct {
+	freedom.Repository
+	Inbox *InboxImpl
+	Tx    *transaction.GormImpl
+}
+
+var (
+	setupOnce  sync.Once
+	testUnit   freedom.UnitTest
+	testDB     *gorm.DB
+	testServer *miniredis.Miniredis
+)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindRepository(func() *testRepository {
+			return &testRepository{}
+		})
+	})
+}
+
+// newTestRepository returns a repository with the inbox, the application runs
+// with a sqlite database and a miniredis.
+func newTestRepository(t *testing.T, c Config) *testRepository {
+	setupOnce.Do(func() {
+		var err error
+		testDB, err = gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testServer, err = miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		Install(Config{})
+		testUnit = freedom.NewUnitTest()
+		testUnit.InstallDB(func() interface{} {
+			return testDB
+		})
+		testUnit.InstallRedis(func() redis.Cmdable {
+			return redis.NewClient(&redis.Options{Addr: testServer.Addr()})
+		})
+		testUnit.Run()
+	})
+	Install(c)
+	t.Cleanup(func() {
+		pruner.installed = false
+	})
+
+	var repo *testRepository
+	testUnit.FetchRepository(&repo)
+	return repo
+}
+
+func TestInstall(t *testing.T) {
+	inbox := &InboxImpl{}
+	if err := inbox.Process("1", func() error { return nil }); err == nil {
+		t.Fatal("the inbox is not installed")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the backend 'mongo' is accepted")
+			}
+		}()
+		Install(Config{Backend: "mongo"})
+	}()
+
+	Install(Config{Backend: Redis})
+	defer func() { pruner.installed = false }()
+	if conf.Table != "freedom_inbox" || conf.Retention != 7*24*time.Hour || conf.Lease != time.Minute {
+		t.Fatalf("conf = %+v", conf)
+	}
+}
+
+// testDedupe processes the event with a duplicate in progress, a failure and a duplicate.
+func testDedupe(t *testing.T, inbox *InboxImpl, id string) {
+	errFailed := errors.New("failed")
+	runs := 0
+	err := inbox.Process(id, func() error {
+		runs++
+		if err := inbox.Process(id, func() error { runs++; return nil }); !errors.Is(err, ErrInProgress) {
+			t.Fatalf("the duplicate of an event in progress = %v, want ErrInProgress", err)
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) || runs != 1 {
+		t.Fatalf("the failed event = %v, runs:%d", err, runs)
+	}
+
+	if err := inbox.Process(id, func() error { runs++; return nil }); err != nil || runs != 2 {
+		t.Fatalf("the failed event must be processed again, error:%v, runs:%d", err, runs)
+	}
+	if err := inbox.Process(id, func() error { runs++; return nil }); err != nil || runs != 2 {
+		t.Fatalf("the duplicate must be skipped, error:%v, runs:%d", err, runs)
+	}
+}
+
+func TestProcessDB(t *testing.T) {
+	repo := newTestRepository(t, Config{Backend: DB, Lease: time.Minute})
+	inbox := repo.Inbox
+	testDedupe(t, inbox, "db-1")
+
+	//The lease of a crashed handler is taken over after it expires
+	now := time.Now()
+	if err := testDB.Table(conf.Table).Create(&Record{Identity: "db-2", Status: StatusProcessing, Expires: now.Add(time.Minute), Created: now}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := inbox.Process("db-2", func() error { return nil }); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("the leased event = %v, want ErrInProgress", err)
+	}
+	testDB.Table(conf.Table).Where("identity = ?", "db-2").Update("expires", now.Add(-time.Second))
+	runs := 0
+	if err := inbox.Process("db-2", func() error { runs++; return nil }); err != nil || runs != 1 {
+		t.Fatalf("the expired lease must be taken over, error:%v, runs:%d", err, runs)
+	}
+	var record Record
+	if err := testDB.Table(conf.Table).Where("identity = ?", "db-2").Take(&record).Error; err != nil || record.Status != StatusDone {
+		t.Fatalf("the event must be recorded, record:%+v, error:%v", record, err)
+	}
+}
+
+func TestProcessDBTransaction(t *testing.T) {
+	repo := newTestRepository(t, Config{Backend: DB})
+	errFailed := errors.New("failed")
+	runs := 0
+	process := func() error {
+		return repo.Inbox.Process("tx-1", func() error {
+			runs++
+			return nil
+		})
+	}
+
+	//The record is rolled back with the transaction
+	err := repo.Tx.Execute(func() error {
+		if err := process(); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) || runs != 1 {
+		t.Fatalf("the rolled back event = %v, runs:%d", err, runs)
+	}
+	if err := repo.Tx.Execute(process); err != nil || runs != 2 {
+		t.Fatalf("the rolled back event must be processed again, error:%v, runs:%d", err, runs)
+	}
+	if err := repo.Tx.Execute(process); err != nil || runs != 2 {
+		t.Fatalf("the committed event must be skipped, error:%v, runs:%d", err, runs)
+	}
+}
+
+func TestProcessRedis(t *testing.T) {
+	inbox := newTestRepository(t, Config{Backend: Redis}).Inbox
+	testDedupe(t, inbox, "redis-1")
+	if status, _ := testServer.Get("inbox:redis-1"); status != "done" {
+		t.Fatalf("the event must be recorded, status:%s", status)
+	}
+}
@@ -2,14 +2,20 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/8treenet/freedom/infra/requests"
 
 	"github.com/8treenet/freedom"
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func init() {
@@ -43,6 +49,14 @@ type ConsumerConfig struct {
 	RateLimit int
 	// 优雅关闭超时时间（默认3秒）
 	CloseTimeout time.Duration
+	// KeyLanes is the number of the lanes of a partition in the EventKeyOrdered mode, 16 by default.
+	KeyLanes int
+	// DirectDispatch serves the messages with the router of the application instead
+	// of posting them to ProxyAddr, the middlewares, the Worker and the Bus are the same.
+	// The consumer starts once the application is ready.
+	DirectDispatch bool
+	// RetryPolicies of the topics, a failed message of a topic without a policy is not retried.
+	RetryPolicies map[string]*RetryPolicy
 }
 
 // Consumer Kafka Consumer interface definition.
@@ -58,22 +72,30 @@ type Consumer interface {
 // ConsumerImpl Kafka Consumer implementation.
 type ConsumerImpl struct {
 	freedom.Infra
-	topicPath       map[string]string
-	topicSequential map[string]bool // 存储每个topic的串行/并行配置
-	config          *sarama.Config
-	client          sarama.ConsumerGroup
-	cancel          context.CancelFunc
-	wg              sync.WaitGroup
-	proxyH2C        bool
-	proxyAddr       string
-	addrs           []string
-	groupID         string
-	rateLimit       int
-	proxyTimeout    time.Duration
-	closeTimeout    time.Duration
-	h2cClient       requests.Client
-	httpClient      requests.Client
-	workerPool      *WorkerPool
+	topicPath      map[string]string
+	topicMode      map[string]freedom.EventMode // 存储每个topic的处理模式
+	config         *sarama.Config
+	client         sarama.ConsumerGroup
+	kafkaClient    sarama.Client
+	clientMu       sync.RWMutex // 保护kafkaClient，健康检查与Close并发
+	consumeErr     atomic.Value
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	proxyH2C       bool
+	proxyAddr      string
+	addrs          []string
+	groupID        string
+	rateLimit      int
+	proxyTimeout   time.Duration
+	closeTimeout   time.Duration
+	h2cClient      requests.Client
+	httpClient     requests.Client
+	workerPool     *WorkerPool
+	keyLanes       int
+	directDispatch bool
+	router         http.Handler
+	retryPolicies  map[string]*RetryPolicy
+	retryOrigin    map[string]string // 重试topic对应的原始topic
 }
 
 // WorkerPool
@@ -176,6 +198,18 @@ func (c *ConsumerImpl) Start(config *ConsumerConfig) {
 		c.closeTimeout = 3 * time.Second // 默认3秒
 	}
 
+	c.keyLanes = config.KeyLanes
+	if c.keyLanes <= 0 {
+		c.keyLanes = 16
+	}
+
+	c.directDispatch = config.DirectDispatch
+	c.retryPolicies = make(map[string]*RetryPolicy, len(config.RetryPolicies))
+	for topic, policy := range config.RetryPolicies {
+		if policy != nil {
+			c.retryPolicies[topic] = policy.normalized()
+		}
+	}
 	c.config.Consumer.Return.Errors = false
 }
 
@@ -198,13 +232,28 @@ func (c *ConsumerImpl) Booting(bootManager freedom.BootManager) {
 	c.workerPool = NewWorkerPool(c.rateLimit)
 
 	c.topicPath = bootManager.EventsPath(c)
-	c.topicSequential = bootManager.EventsSequential(c)
-	bootManager.RegisterShutdown(func() {
-		if err := c.Close(); err != nil {
-			freedom.Logger().Error(err)
-		}
+	c.topicMode = bootManager.EventsMode(c)
+	c.initRetryTopics()
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "kafka-consumer",
+		Phase: freedom.OnDrain,
+		Func: func(ctx context.Context) error {
+			return c.Close()
+		},
 	})
 
+	if c.directDispatch {
+		//The router is built when the application runs
+		c.router = bootManager.Iris()
+		bootManager.RegisterHook(freedom.LifecycleHook{
+			Name:  "kafka-consumer",
+			Phase: freedom.OnReady,
+			Func: func(ctx context.Context) error {
+				return c.listen()
+			},
+		})
+		return
+	}
 	if err := c.listen(); err != nil {
 		panic(err)
 	}
@@ -220,11 +269,19 @@ func (c *ConsumerImpl) listen() error {
 	var ctx context.Context
 
 	ctx, c.cancel = context.WithCancel(context.Background())
-	client, err := sarama.NewConsumerGroup(c.addrs, c.groupID, c.config)
+	kafkaClient, err := sarama.NewClient(c.addrs, c.config)
+	if err != nil {
+		return err
+	}
+	client, err := sarama.NewConsumerGroupFromClient(c.groupID, kafkaClient)
 	if err != nil {
+		kafkaClient.Close()
 		return err
 	}
 	freedom.Logger().Debug("[Freedom] Consumer connect servers: ", c.addrs)
+	c.clientMu.Lock()
+	c.kafkaClient = kafkaClient
+	c.clientMu.Unlock()
 	c.client = client
 	c.wg.Add(1)
 	go func() {
@@ -238,6 +295,7 @@ func (c *ConsumerImpl) listen() error {
 				consumer: c,
 			}); err != nil {
 				freedom.Logger().Errorf("[Freedom] Error from consumer: %v", err)
+				c.consumeErr.Store(consumeError{err})
 				time.Sleep(5 * time.Second)
 			}
 			// check if context was cancelled, signaling that the consumer should stop
@@ -264,12 +322,42 @@ func (c *ConsumerImpl) Close() error {
 
 	c.wg.Wait()
 
+	c.clientMu.Lock()
+	kafkaClient := c.kafkaClient
+	c.kafkaClient = nil
+	c.clientMu.Unlock()
 	defer func() {
 		c.cancel = nil
 		c.client = nil
 		c.workerPool = nil
 	}()
-	return c.client.Close()
+	if err := c.client.Close(); err != nil {
+		return err
+	}
+	return kafkaClient.Close()
+}
+
+// consumeError wraps the last error of the consumer group, atomic.Value cannot store nil.
+type consumeError struct {
+	err error
+}
+
+// HealthCheck Reports whether the consumer group is consuming.
+// A consumer that is not started is healthy.
+func (c *ConsumerImpl) HealthCheck(ctx context.Context) error {
+	if len(c.addrs) == 0 || len(c.topicPath) == 0 {
+		return nil
+	}
+	c.clientMu.RLock()
+	kafkaClient := c.kafkaClient
+	c.clientMu.RUnlock()
+	if kafkaClient == nil || kafkaClient.Closed() {
+		return errors.New("consumer is not connected")
+	}
+	if last, ok := c.consumeErr.Load().(consumeError); ok && last.err != nil {
+		return fmt.Errorf("consume failed: %w", last.err)
+	}
+	return clusterHealth(ctx, kafkaClient)
 }
 
 func (c *ConsumerImpl) do(msg *sarama.ConsumerMessage) (e error) {
@@ -286,25 +374,67 @@ func (c *ConsumerImpl) do(msg *sarama.ConsumerMessage) (e error) {
 		freedom.Logger().Error("[Freedom] Undefined 'topic' :", msg.Topic)
 		return
 	}
+	//The budget starts when the message is consumed, the clock of the producer may not agree
+	start := time.Now()
+	ctx := context.Background()
+	for index := 0; index < len(msg.Headers); index++ {
+		if !strings.EqualFold(string(msg.Headers[index].Key), freedom.DeadlineHeader) {
+			continue
+		}
+		if deadline, ok := freedom.ParseDeadline(string(msg.Headers[index].Value), start); ok {
+			if !time.Now().Before(deadline) {
+				freedom.Logger().Errorf("[Freedom] Skip the expired message, path:%s, topic:%s, key:%s", path, msg.Topic, string(msg.Key))
+				return
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+	}
+
+	ctx, span := startConsumerSpan(ctx, msg)
+	defer func() {
+		endSpan(span, e)
+	}()
+
+	header := make(http.Header)
+	for index := 0; index < len(msg.Headers); index++ {
+		header.Set(string(msg.Headers[index].Key), string(msg.Headers[index].Value))
+	}
+	header.Set("x-message-key", string(msg.Key))
+	if budget, ok := freedom.DeadlineBudget(ctx); ok {
+		header.Set(freedom.DeadlineHeader, budget)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+
+	var (
+		code int
+		err  error
+	)
+	if c.directDispatch {
+		code, err = c.serve(ctx, path, msg.Value, header)
+	} else {
+		code, err = c.proxy(ctx, path, msg.Value, header)
+	}
+	if err != nil || code != 200 {
+		freedom.Logger().Errorf("[Freedom] Call message processing failed, path:%s, topic:%s, addr:%v, body:%v, error:%v", path, msg.Topic, c.addrs, string(msg.Value), err)
+		e = fmt.Errorf("http code:%d, err:%w", code, err)
+	}
+	return
+}
+
+// proxy posts the message to the proxy address.
+func (c *ConsumerImpl) proxy(ctx context.Context, path string, body []byte, header http.Header) (int, error) {
 	var request requests.Request
 	if c.proxyH2C {
 		request = requests.NewH2CRequest(c.proxyAddr + path).SetClient(c.h2cClient)
 	} else {
 		request = requests.NewHTTPRequest(c.proxyAddr + path).SetClient(c.httpClient)
 	}
-
-	request = request.SetBody(msg.Value)
-	for index := 0; index < len(msg.Headers); index++ {
-		request = request.SetHeaderValue(string(msg.Headers[index].Key), string(msg.Headers[index].Value))
-	}
-	request.SetHeaderValue("x-message-key", string(msg.Key))
+	request = request.SetBody(body).SetHeader(header)
+	request.WithContext(ctx)
 	_, resp := request.Post().ToString()
-
-	if resp.Error != nil || resp.StatusCode != 200 {
-		freedom.Logger().Errorf("[Freedom] Call message processing failed, path:%s, topic:%s, addr:%v, body:%v, error:%v", path, msg.Topic, c.addrs, string(msg.Value), resp.Error)
-		e = fmt.Errorf("http code:%d, err:%w", resp.StatusCode, resp.Error)
-	}
-	return
+	return resp.StatusCode, resp.Error
 }
 
 type consumerHandle struct {
@@ -312,6 +442,7 @@ type consumerHandle struct {
 }
 
 func (consumerHandle *consumerHandle) Setup(sarama.ConsumerGroupSession) error {
+	consumerHandle.consumer.consumeErr.Store(consumeError{})
 	return nil
 }
 
@@ -328,26 +459,121 @@ func (consumerHandle *consumerHandle) ConsumeClaim(session sarama.ConsumerGroupS
 	// The `ConsumeClaim` itself is called within a goroutine, see:
 	// https://github.com/IBM/sarama/blob/main/consumer_group.go#L27-L29
 
+	// 检查当前topic的处理模式，如果没有配置则串行处理
+	mode, exists := consumerHandle.consumer.topicMode[claim.Topic()]
+	if !exists {
+		mode = freedom.EventSequential
+	}
+	if mode != freedom.EventSequential {
+		return consumerHandle.consumeConcurrently(session, claim, mode)
+	}
+
 	for message := range claim.Messages() {
-		// 检查当前topic的串行/并行配置，如果没有配置则使用全局默认配置
-		sequential, exists := consumerHandle.consumer.topicSequential[message.Topic]
-		if !exists {
-			sequential = true // 使用默认配置
+		// 串行处理
+		if !sleepContext(session.Context(), consumerHandle.consumer.retryDelay(message)) {
+			return nil
+		}
+		//The session ends and the message is delivered again to the next session
+		if err := consumerHandle.consumer.handle(session.Context(), message); err != nil {
+			return redeliver(session, message, err)
 		}
+		session.MarkMessage(message, "")
+	}
+	return nil
+}
+
+// redeliver returns the error that stops the claim at the message, the message
+// and the ones after it are consumed again by the next session. It is nil if the
+// session has ended.
+func redeliver(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, err error) error {
+	if session.Context().Err() != nil {
+		return nil
+	}
+	freedom.Logger().Errorf("[Freedom] Stop consuming the partition, the message will be delivered again, topic:%s, partition:%d, offset:%d, key:%s, error:%v",
+		message.Topic, message.Partition, message.Offset, string(message.Key), err)
+	return fmt.Errorf("the message of topic %s, partition %d, offset %d failed: %w", message.Topic, message.Partition, message.Offset, err)
+}
 
-		if sequential {
-			// 串行处理
-			if err := consumerHandle.consumer.do(message); err != nil {
-				continue
+// consumeConcurrently processes the messages with the worker pool, or on the
+// lanes of their keys in the key-ordered mode. Only the highest contiguous
+// completed offset is marked. A message that must be delivered again stops the
+// claim, it is never marked and the session ends. The messages of a retry topic
+// are dispatched when they are due, a failed message waits for its next attempt
+// in place without holding a worker of the pool.
+func (consumerHandle *consumerHandle) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, mode freedom.EventMode) error {
+	consumer := consumerHandle.consumer
+	tracker := newOffsetTracker(consumer.rateLimit, func(offset int64) {
+		session.MarkOffset(claim.Topic(), claim.Partition(), offset, "")
+	})
+	ctx, cancel := context.WithCancelCause(session.Context())
+	defer cancel(nil)
+	finish := func(message *sarama.ConsumerMessage, err error) {
+		if err != nil {
+			tracker.abandon()
+			cancel(redeliver(session, message, err))
+			return
+		}
+		tracker.complete(message.Offset)
+	}
+	process := func(message *sarama.ConsumerMessage) {
+		//The message is redelivered to the next session
+		if ctx.Err() != nil {
+			tracker.abandon()
+			return
+		}
+		finish(message, consumer.handle(session.Context(), message))
+	}
+
+	var submit func(message *sarama.ConsumerMessage, attempt int)
+	submit = func(message *sarama.ConsumerMessage, attempt int) {
+		consumer.workerPool.Submit(func() {
+			if ctx.Err() != nil {
+				tracker.abandon()
+				return
 			}
-			session.MarkMessage(message, "")
+			backoff, err := consumer.attempt(session.Context(), message, attempt)
+			if backoff == 0 {
+				finish(message, err)
+				return
+			}
+			go func() {
+				if !sleepContext(ctx, backoff) {
+					tracker.abandon()
+					return
+				}
+				submit(message, attempt+1)
+			}()
+		})
+	}
+
+	var lanes *keyLanes
+	if mode == freedom.EventKeyOrdered {
+		lanes = newKeyLanes(consumer.keyLanes, max(consumer.rateLimit/consumer.keyLanes, 1), process)
+	}
+	for message := range claim.Messages() {
+		if !sleepContext(ctx, consumer.retryDelay(message)) || !tracker.start(ctx, message.Offset) {
+			break
+		}
+		if lanes == nil {
+			submit(message, 1)
 			continue
 		}
+		if !lanes.dispatch(ctx, message) {
+			tracker.abandon()
+			break
+		}
+	}
 
-		consumerHandle.consumer.workerPool.Submit(func() {
-			consumerHandle.consumer.do(message)
-		})
-		session.MarkMessage(message, "")
+	if lanes != nil {
+		lanes.close()
+	}
+	//The completed offsets are marked before the session commits
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), consumer.closeTimeout)
+	defer waitCancel()
+	tracker.wait(waitCtx)
+	//The cause is context.Canceled if the session has ended
+	if err := context.Cause(ctx); err != nil && err != context.Canceled {
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/IBM/sarama"
+)
+
+// ErrSkipped The message is skipped by a consumer middleware.
+var ErrSkipped = errors.New("kafka: the message is skipped")
+
+// errNotProcessed The consumer middlewares returned without processing, skipping or failing the message.
+var errNotProcessed = errors.New("kafka: a consumer middleware did not call Next, Skip or Fail")
+
+// ConsumerMsg The consumed message seen by the consumer middlewares.
+// It is a copy of the message of the attempt, the retry topics and the
+// dead-letter topic receive the original message.
+type ConsumerMsg struct {
+	*sarama.ConsumerMessage
+	ctx       context.Context
+	stop      bool
+	nextIndex int
+	err       error
+	done      bool
+	do        func(*sarama.ConsumerMessage) error
+}
+
+// newConsumerMsg copies msg, do processes the message after the middlewares.
+func newConsumerMsg(ctx context.Context, msg *sarama.ConsumerMessage, do func(*sarama.ConsumerMessage) error) *ConsumerMsg {
+	clone := *msg
+	clone.Headers = append([]*sarama.RecordHeader(nil), msg.Headers...)
+	return &ConsumerMsg{ConsumerMessage: &clone, ctx: ctx, do: do}
+}
+
+// Context Returns the context of the consumer session.
+func (msg *ConsumerMsg) Context() context.Context {
+	return msg.ctx
+}
+
+// Next Perform the next step, typically for the control of middleware.
+func (msg *ConsumerMsg) Next() {
+	if msg.IsStopped() {
+		return
+	}
+	if msg.nextIndex == len(consumerMiddlewares) {
+		msg.done = true
+		msg.err = msg.do(msg.ConsumerMessage)
+		return
+	}
+	msg.nextIndex = msg.nextIndex + 1
+	consumerMiddlewares[msg.nextIndex-1](msg)
+}
+
+// IsStopped whether it has stopped.
+func (msg *ConsumerMsg) IsStopped() bool {
+	return msg.stop
+}
+
+// Skip Stops the execution, the message is marked without being processed.
+func (msg *ConsumerMsg) Skip() *ConsumerMsg {
+	msg.stop = true
+	msg.err = ErrSkipped
+	return msg
+}
+
+// Fail Stops the execution with err, the message is retried with the retry policy of its topic.
+func (msg *ConsumerMsg) Fail(err error) *ConsumerMsg {
+	msg.stop = true
+	msg.err = err
+	return msg
+}
+
+// Delay Waits for d before the next step, the message fails if the session ends first.
+func (msg *ConsumerMsg) Delay(d time.Duration) *ConsumerMsg {
+	if !sleepContext(msg.ctx, d) {
+		msg.Fail(msg.ctx.Err())
+	}
+	return msg
+}
+
+// GetExecution Get the results of the execution, ErrSkipped if the message is skipped.
+func (msg *ConsumerMsg) GetExecution() error {
+	return msg.err
+}
+
+// GetMessageKey Returns the key of the message.
+func (msg *ConsumerMsg) GetMessageKey() string {
+	return string(msg.Key)
+}
+
+// GetHeader Returns the value of the header.
+func (msg *ConsumerMsg) GetHeader(key string) string {
+	return consumerHeader(msg.ConsumerMessage, key)
+}
+
+// SetHeader Sets the value of the header, the message is processed with it.
+func (msg *ConsumerMsg) SetHeader(key, value string) *ConsumerMsg {
+	msg.DelHeader(key)
+	msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	return msg
+}
+
+// DelHeader Deletes the header.
+func (msg *ConsumerMsg) DelHeader(key string) *ConsumerMsg {
+	headers := msg.Headers[:0]
+	for _, record := range msg.Headers {
+		if !strings.EqualFold(string(record.Key), key) {
+			headers = append(headers, record)
+		}
+	}
+	msg.Headers = headers
+	return msg
+}
+
+// process runs the consumer middlewares, then processes the message.
+// A panic of the middlewares fails the message, so does a middleware that
+// returns without calling Next, Skip or Fail.
+func (c *ConsumerImpl) process(ctx context.Context, msg *sarama.ConsumerMessage) (e error) {
+	if len(consumerMiddlewares) == 0 {
+		return c.do(msg)
+	}
+	defer func() {
+		if perr := recover(); perr != nil {
+			e = fmt.Errorf("panic: %v", perr)
+			freedom.Logger().Errorf("[Freedom] The consumer middleware panicked, topic:%s, key:%s, error:%v", msg.Topic, string(msg.Key), e)
+		}
+	}()
+
+	consumerMsg := newConsumerMsg(ctx, msg, c.do)
+	consumerMsg.Next()
+	if !consumerMsg.done && !consumerMsg.stop {
+		freedom.Logger().Errorf("[Freedom] The consumed message is not processed, topic:%s, key:%s, error:%v", msg.Topic, string(msg.Key), errNotProcessed)
+		return errNotProcessed
+	}
+	if errors.Is(consumerMsg.err, ErrSkipped) {
+		return nil
+	}
+	return consumerMsg.err
+}
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestConsumerMiddleware(t *testing.T) {
+	defer func() {
+		consumerMiddlewares = nil
+	}()
+	errTenant := errors.New("unknown tenant")
+	InstallConsumerMiddleware(func(msg *ConsumerMsg) {
+		switch msg.GetHeader("x-tenant") {
+		case "":
+			msg.Skip()
+		case "unknown":
+			msg.Fail(errTenant)
+		}
+		msg.SetHeader("x-tenant", "t-"+msg.GetHeader("x-tenant"))
+		msg.Next()
+	})
+
+	var processed []string
+	do := func(msg *sarama.ConsumerMessage) error {
+		processed = append(processed, consumerHeader(msg, "x-tenant"))
+		return nil
+	}
+	run := func(tenant string) error {
+		msg := &sarama.ConsumerMessage{Topic: "event-sell"}
+		if tenant != "" {
+			msg.Headers = []*sarama.RecordHeader{{Key: []byte("X-Tenant"), Value: []byte(tenant)}}
+		}
+		consumerMsg := newConsumerMsg(context.Background(), msg, do)
+		consumerMsg.Next()
+		if len(msg.Headers) > 0 && string(msg.Headers[0].Value) != tenant {
+			t.Fatal("the original message is changed")
+		}
+		return consumerMsg.GetExecution()
+	}
+
+	if err := run("1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(""); !errors.Is(err, ErrSkipped) {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	if err := run("unknown"); !errors.Is(err, errTenant) {
+		t.Fatalf("GetExecution() = %v", err)
+	}
+	if len(processed) != 1 || processed[0] != "t-1" {
+		t.Fatalf("processed = %v", processed)
+	}
+}
+
+func TestConsumerMiddlewareFailure(t *testing.T) {
+	defer func() {
+		consumerMiddlewares = nil
+	}()
+	InstallConsumerMiddleware(func(msg *ConsumerMsg) {
+		switch msg.GetMessageKey() {
+		case "panic":
+			panic("broken middleware")
+		case "skip":
+			msg.Skip()
+		}
+	})
+
+	c := new(ConsumerImpl)
+	process := func(key string) error {
+		return c.process(context.Background(), &sarama.ConsumerMessage{Topic: "event-sell", Key: []byte(key)})
+	}
+	if err := process("panic"); err == nil {
+		t.Fatal("the panic of a middleware must fail the message")
+	}
+	if err := process("forgotten"); !errors.Is(err, errNotProcessed) {
+		t.Fatalf("a middleware without Next, Skip or Fail must fail the message, error:%v", err)
+	}
+	if err := process("skip"); err != nil {
+		t.Fatalf("the skipped message must succeed, error:%v", err)
+	}
+}
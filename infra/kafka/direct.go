@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// serve processes the message with the router of the application, like a request
+// posted to the path.
+func (c *ConsumerImpl) serve(ctx context.Context, path string, body []byte, header http.Header) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header = header
+	request.RemoteAddr = "127.0.0.1:0"
+
+	recorder := newResponseRecorder()
+	c.router.ServeHTTP(recorder, request)
+	if recorder.code != http.StatusOK {
+		return recorder.code, fmt.Errorf("%s", recorder.body.String())
+	}
+	return recorder.code, nil
+}
+
+// responseRecorder records the response of the router.
+type responseRecorder struct {
+	header http.Header
+	body   bytes.Buffer
+	code   int
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), code: http.StatusOK}
+}
+
+// Header .
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+// Write .
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+// WriteHeader .
+func (r *responseRecorder) WriteHeader(code int) {
+	r.code = code
+}
+
+// Flush .
+func (r *responseRecorder) Flush() {}
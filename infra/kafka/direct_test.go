@@ -0,0 +1,30 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	consumer := &ConsumerImpl{router: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Path != "/goods/shop" || r.Header.Get("x-message-key") != "1" {
+			t.Fatalf("unexpected request %s %s %v", r.Method, r.URL.Path, r.Header)
+		}
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("failed"))
+		}
+	})}
+	header := http.Header{}
+	header.Set("x-message-key", "1")
+
+	if code, err := consumer.serve(context.Background(), "/goods/shop", []byte("{}"), header); code != http.StatusOK || err != nil {
+		t.Fatalf("serve() = %d, %v", code, err)
+	}
+	if code, err := consumer.serve(context.Background(), "/goods/shop", []byte("fail"), header); code != http.StatusInternalServerError || err == nil {
+		t.Fatalf("serve() = %d, %v", code, err)
+	}
+}
@@ -0,0 +1,28 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+
+	"github.com/IBM/sarama"
+)
+
+// clusterHealth sends a lightweight request to a broker of the client.
+func clusterHealth(ctx context.Context, client sarama.Client) error {
+	broker := client.LeastLoadedBroker()
+	if broker == nil {
+		return errors.New("no available broker")
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := broker.ApiVersions(&sarama.ApiVersionsRequest{})
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
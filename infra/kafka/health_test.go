@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestProducerHealthCheckDuringClose(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()),
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+	})
+
+	pi := new(ProducerImpl)
+	pi.Start([]string{broker.Addr()}, sarama.NewConfig())
+	if err := pi.dial(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pi.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("the connected producer is not healthy, error:%v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			pi.HealthCheck(context.Background())
+		}
+	}()
+	if err := pi.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if err := pi.HealthCheck(context.Background()); err == nil {
+		t.Fatal("the closed producer must not be healthy")
+	}
+}
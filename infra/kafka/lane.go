@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// keyLanes processes the messages of a key in order on one lane, the lanes run concurrently.
+type keyLanes struct {
+	lanes []chan *sarama.ConsumerMessage
+	wg    sync.WaitGroup
+}
+
+// newKeyLanes starts n lanes that call process with the messages in order.
+func newKeyLanes(n, buffer int, process func(*sarama.ConsumerMessage)) *keyLanes {
+	l := &keyLanes{lanes: make([]chan *sarama.ConsumerMessage, n)}
+	for index := range l.lanes {
+		lane := make(chan *sarama.ConsumerMessage, buffer)
+		l.lanes[index] = lane
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			for msg := range lane {
+				process(msg)
+			}
+		}()
+	}
+	return l
+}
+
+// dispatch sends the message to the lane of its key, it returns false if ctx is done first.
+// The messages without a key are spread by their offset.
+func (l *keyLanes) dispatch(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	select {
+	case l.lanes[laneIndex(msg.Key, msg.Offset, len(l.lanes))] <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close waits for the lanes to process the dispatched messages.
+func (l *keyLanes) close() {
+	for _, lane := range l.lanes {
+		close(lane)
+	}
+	l.wg.Wait()
+}
+
+func laneIndex(key []byte, offset int64, n int) int {
+	if len(key) == 0 {
+		return int(offset % int64(n))
+	}
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestKeyLanes(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		orders = map[string][]int64{}
+	)
+	lanes := newKeyLanes(4, 2, func(msg *sarama.ConsumerMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		orders[string(msg.Key)] = append(orders[string(msg.Key)], msg.Offset)
+	})
+	keys := []string{"order-1", "order-2", "order-3"}
+	for offset := int64(0); offset < 30; offset++ {
+		msg := &sarama.ConsumerMessage{Key: []byte(keys[offset%3]), Offset: offset}
+		if !lanes.dispatch(context.Background(), msg) {
+			t.Fatal("dispatch() = false")
+		}
+	}
+	lanes.close()
+
+	for key, offsets := range orders {
+		if len(offsets) != 10 {
+			t.Fatalf("%s has %d messages", key, len(offsets))
+		}
+		for index := 1; index < len(offsets); index++ {
+			if offsets[index] < offsets[index-1] {
+				t.Fatalf("%s is out of order: %v", key, offsets)
+			}
+		}
+	}
+	if laneIndex([]byte("order-1"), 0, 16) != laneIndex([]byte("order-1"), 99, 16) {
+		t.Fatal("the lane of a key changes")
+	}
+}
@@ -10,3 +10,16 @@ type ProducerHandler func(*Msg)
 func InstallMiddleware(handle ...ProducerHandler) {
 	middlewares = append(middlewares, handle...)
 }
+
+var consumerMiddlewares []ConsumerHandler
+
+// ConsumerHandler The function declaration of the Kafka Consumer middleware.
+type ConsumerHandler func(*ConsumerMsg)
+
+// InstallConsumerMiddleware Install the consumer middleware.
+// The middlewares run before every attempt of a consumed message, they can change
+// the headers and the value, skip, delay or fail the message. A middleware must
+// call Next, Skip or Fail, otherwise the message fails like a panic of a middleware.
+func InstallConsumerMiddleware(handle ...ConsumerHandler) {
+	consumerMiddlewares = append(consumerMiddlewares, handle...)
+}
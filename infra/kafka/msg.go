@@ -1,10 +1,13 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/8treenet/freedom"
 	"github.com/IBM/sarama"
 )
 
@@ -18,6 +21,7 @@ type Msg struct {
 	stop       bool
 	nextIndex  int
 	sendErr    error
+	ctx        context.Context
 }
 
 // Publish this message.
@@ -39,6 +43,29 @@ func (msg *Msg) SetHeader(head map[string]interface{}) *Msg {
 	return msg
 }
 
+// SetWorker Transfers the bus of the worker with the message. If the worker
+// has a deadline, the remaining budget is sent and bounds the processing of
+// the message from the time it is consumed, an exhausted budget is skipped.
+func (msg *Msg) SetWorker(worker freedom.Worker) *Msg {
+	msg.httpHeader = worker.Bus().Header.Clone()
+	msg.ctx = worker.Context()
+	return msg
+}
+
+// Context Returns the context of the message, set by SetWorker or WithContext.
+func (msg *Msg) Context() context.Context {
+	if msg.ctx == nil {
+		return context.Background()
+	}
+	return msg.ctx
+}
+
+// WithContext Sets the context of the message, the deadline of ctx is sent with the message.
+func (msg *Msg) WithContext(ctx context.Context) *Msg {
+	msg.ctx = ctx
+	return msg
+}
+
 // Next Perform the next step, typically for the control of middleware.
 func (msg *Msg) Next() {
 	if len(middlewares) == 0 {
@@ -88,6 +115,15 @@ func (msg *Msg) GetHeader() map[string]interface{} {
 	return msg.header
 }
 
+func (msg *Msg) hasHeader(key string) bool {
+	for name := range msg.header {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
 func (msg *Msg) do() error {
 	if msg.key == "" {
 		msg.key = producer.generateMessageKey()
@@ -99,7 +135,21 @@ func (msg *Msg) do() error {
 		Timestamp: time.Now(),
 	}
 	for key := range msg.httpHeader {
-		saramaMsg.Headers = append(saramaMsg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(msg.httpHeader.Get(key))})
+		//The header set by SetHeader takes precedence over the bus
+		//The event id of the consumed message is not passed on
+		if msg.hasHeader(key) || strings.EqualFold(key, freedom.EventIDHeader) {
+			continue
+		}
+		value := msg.httpHeader.Get(key)
+		//The message is a new span of the trace
+		if tc, ok := freedom.ParseTraceparent(value); ok && strings.EqualFold(key, freedom.TraceparentHeader) {
+			value = tc.Child().String()
+		}
+		saramaMsg.Headers = append(saramaMsg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+
+	if budget, ok := freedom.DeadlineBudget(msg.ctx); ok {
+		saramaMsg.Headers = append(saramaMsg.Headers, sarama.RecordHeader{Key: []byte(freedom.DeadlineHeader), Value: []byte(budget)})
 	}
 
 	for key, value := range msg.header {
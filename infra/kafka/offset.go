@@ -0,0 +1,83 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+)
+
+// offsetTracker tracks the messages of a partition processed concurrently.
+// Only the highest contiguous completed offset is marked, so a crash never
+// commits past a message that has not completed.
+type offsetTracker struct {
+	mu sync.Mutex
+	// pending are the started offsets in order, the head is the lowest not marked.
+	pending []int64
+	done    map[int64]bool
+	// slots bounds the started offsets that are not marked, a slow message at
+	// the head stops the consumption of the partition at the window.
+	slots chan struct{}
+	wg    sync.WaitGroup
+	mark  func(offset int64)
+}
+
+// newOffsetTracker returns a tracker, mark is called with the next offset to consume.
+func newOffsetTracker(window int, mark func(offset int64)) *offsetTracker {
+	return &offsetTracker{
+		done:  make(map[int64]bool),
+		slots: make(chan struct{}, window),
+		mark:  mark,
+	}
+}
+
+// start records the offset before it is processed, it waits while the window is full.
+// It returns false if ctx is done first.
+func (t *offsetTracker) start(ctx context.Context, offset int64) bool {
+	select {
+	case t.slots <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	t.mu.Lock()
+	t.pending = append(t.pending, offset)
+	t.mu.Unlock()
+	t.wg.Add(1)
+	return true
+}
+
+// complete records the offset as processed and marks the contiguous completed offsets.
+func (t *offsetTracker) complete(offset int64) {
+	defer t.wg.Done()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+	marked := int64(-1)
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		marked = t.pending[0]
+		delete(t.done, marked)
+		t.pending = t.pending[1:]
+		<-t.slots
+	}
+	if marked >= 0 {
+		t.mark(marked + 1)
+	}
+}
+
+// abandon releases a started offset that is not processed, it is never marked
+// and the session must end.
+func (t *offsetTracker) abandon() {
+	t.wg.Done()
+}
+
+// wait waits for the started offsets until ctx is done.
+func (t *offsetTracker) wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/IBM/sarama"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	var marked []int64
+	tracker := newOffsetTracker(3, func(offset int64) {
+		marked = append(marked, offset)
+	})
+	ctx := context.Background()
+	for _, offset := range []int64{10, 11, 13} {
+		if !tracker.start(ctx, offset) {
+			t.Fatal("start() = false")
+		}
+	}
+
+	//The window is full until the head completes
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if tracker.start(timeout, 14) {
+		t.Fatal("the window is not full")
+	}
+
+	tracker.complete(11)
+	tracker.complete(13)
+	if len(marked) != 0 {
+		t.Fatalf("marked = %v before the head completes", marked)
+	}
+	tracker.complete(10)
+	if len(marked) != 1 || marked[0] != 14 {
+		t.Fatalf("marked = %v, want [14]", marked)
+	}
+	if !tracker.start(ctx, 14) {
+		t.Fatal("start() = false")
+	}
+	tracker.complete(14)
+	tracker.wait(ctx)
+	if marked[len(marked)-1] != 15 {
+		t.Fatalf("marked = %v, want 15 last", marked)
+	}
+}
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	mu     sync.Mutex
+	marked int64
+}
+
+func (s *testSession) Context() context.Context { return s.ctx }
+
+func (s *testSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = max(s.marked, offset)
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Topic() string                            { return "orders" }
+func (c *testClaim) Partition() int32                         { return 0 }
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestConsumeConcurrently(t *testing.T) {
+	defer func() {
+		consumerMiddlewares = nil
+	}()
+	InstallConsumerMiddleware(func(msg *ConsumerMsg) {
+		if msg.Offset == 5 {
+			msg.Fail(errors.New("failed"))
+			return
+		}
+		msg.Skip()
+	})
+
+	c := &ConsumerImpl{rateLimit: 4, keyLanes: 2, closeTimeout: time.Second, retryPolicies: map[string]*RetryPolicy{"orders": {}}}
+	for topic, policy := range c.retryPolicies {
+		c.retryPolicies[topic] = policy.normalized()
+	}
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 10)}
+	for offset := int64(0); offset < 10; offset++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Key: []byte(strconv.FormatInt(offset, 10)), Offset: offset}
+	}
+	close(claim.messages)
+
+	session := &testSession{ctx: context.Background()}
+	err := (&consumerHandle{consumer: c}).consumeConcurrently(session, claim, freedom.EventKeyOrdered)
+	if err == nil {
+		t.Fatal("the failed message must stop the claim")
+	}
+	if session.marked > 5 {
+		t.Fatalf("the failed message is marked, the next offset is %d", session.marked)
+	}
+}
@@ -1,7 +1,10 @@
 package kafka
 
 import (
+	"context"
+	"errors"
 	"strings"
+	"sync"
 
 	"github.com/8treenet/freedom"
 	"github.com/IBM/sarama"
@@ -35,6 +38,8 @@ type Producer interface {
 type ProducerImpl struct {
 	freedom.Infra
 	syncProducer sarama.SyncProducer
+	client       sarama.Client
+	clientMu     sync.RWMutex // 保护client，健康检查与Close并发
 	addrs        []string
 	config       *sarama.Config
 }
@@ -62,10 +67,12 @@ func (pi *ProducerImpl) Booting(bootManager freedom.BootManager) {
 		return
 	}
 
-	bootManager.RegisterShutdown(func() {
-		if err := pi.Close(); err != nil {
-			freedom.Logger().Error(err)
-		}
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "kafka-producer",
+		Phase: freedom.OnStop,
+		Func: func(ctx context.Context) error {
+			return pi.Close()
+		},
 	})
 	if err := pi.dial(); err != nil {
 		panic(err)
@@ -73,10 +80,18 @@ func (pi *ProducerImpl) Booting(bootManager freedom.BootManager) {
 }
 
 func (pi *ProducerImpl) dial() error {
-	syncp, err := sarama.NewSyncProducer(pi.addrs, pi.config)
+	client, err := sarama.NewClient(pi.addrs, pi.config)
 	if err != nil {
 		return err
 	}
+	syncp, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	pi.clientMu.Lock()
+	pi.client = client
+	pi.clientMu.Unlock()
 	pi.syncProducer = syncp
 	freedom.Logger().Debug("[Freedom] Producer connect servers: ", pi.addrs)
 	return nil
@@ -88,10 +103,32 @@ func (pi *ProducerImpl) Close() error {
 		return nil
 	}
 
-	defer func() {
-		pi.syncProducer = nil
-	}()
-	return pi.syncProducer.Close()
+	pi.clientMu.Lock()
+	client := pi.client
+	pi.client = nil
+	pi.clientMu.Unlock()
+	err := pi.syncProducer.Close()
+	pi.syncProducer = nil
+	if client == nil {
+		return err
+	}
+	//The client is closed even if the producer fails to close
+	return errors.Join(err, client.Close())
+}
+
+// HealthCheck Reports whether the producer can reach the kafka cluster.
+// A producer that is not started is healthy.
+func (pi *ProducerImpl) HealthCheck(ctx context.Context) error {
+	if len(pi.addrs) == 0 {
+		return nil
+	}
+	pi.clientMu.RLock()
+	client := pi.client
+	pi.clientMu.RUnlock()
+	if client == nil || client.Closed() {
+		return errors.New("producer is not connected")
+	}
+	return clusterHealth(ctx, client)
 }
 
 // generateMessageKey
@@ -0,0 +1,238 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/IBM/sarama"
+)
+
+// The headers of the messages forwarded to a retry topic or the dead-letter topic.
+const (
+	// RetryRoundHeader is the number of the retry topic, starting at 1.
+	RetryRoundHeader = "x-retry-round"
+	// OriginalTopicHeader is the topic the message was consumed from first.
+	OriginalTopicHeader = "x-original-topic"
+	// OriginalPartitionHeader and OriginalOffsetHeader locate the failed message.
+	OriginalPartitionHeader = "x-original-partition"
+	OriginalOffsetHeader    = "x-original-offset"
+	// FailureReasonHeader is the error of the last attempt.
+	FailureReasonHeader = "x-failure-reason"
+	// FailedAtHeader is the time of the last attempt in RFC 3339.
+	FailedAtHeader = "x-failed-at"
+)
+
+// RetryTopic A topic the failed messages are forwarded to, the consumer listens
+// to it with the path of the original topic.
+type RetryTopic struct {
+	Topic string
+	// Delay of the message after it is forwarded, the consumer waits before it processes it.
+	Delay time.Duration
+}
+
+// RetryPolicy The retry policy of a topic.
+// A failed message is attempted in place, then forwarded to the retry topics one
+// after the other, then to the dead-letter topic. It is marked once it is forwarded.
+type RetryPolicy struct {
+	// Attempts in place, 1 by default.
+	Attempts int
+	// Backoff between the attempts in place, 1s by default. It doubles with every attempt.
+	Backoff time.Duration
+	// MaxBackoff is the longest backoff, 30s or Backoff if it is longer by default.
+	MaxBackoff time.Duration
+	// RetryTopics of the message, in order.
+	RetryTopics []RetryTopic
+	// DeadLetterTopic receives the original payload and headers with the failure
+	// reason after the last retry.
+	DeadLetterTopic string
+	// DropAfterRetries drops the message with an error log after the last retry if
+	// there is no DeadLetterTopic. Otherwise the consumption of the partition stops
+	// and the message is delivered again.
+	DropAfterRetries bool
+}
+
+// normalized returns a copy of the policy with the defaults, the policy of the
+// configuration is not changed.
+func (policy RetryPolicy) normalized() *RetryPolicy {
+	if policy.Attempts <= 0 {
+		policy.Attempts = 1
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = time.Second
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = max(30*time.Second, policy.Backoff)
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+	return &policy
+}
+
+// backoff returns the delay after the attempt.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	if attempt >= 32 {
+		return policy.MaxBackoff
+	}
+	if d := policy.Backoff << (attempt - 1); d > 0 && d < policy.MaxBackoff {
+		return d
+	}
+	return policy.MaxBackoff
+}
+
+// initRetryTopics listens to the retry topics with the path and the mode of their original topic.
+func (c *ConsumerImpl) initRetryTopics() {
+	c.retryOrigin = make(map[string]string)
+	for topic, policy := range c.retryPolicies {
+		path, ok := c.topicPath[topic]
+		if !ok {
+			freedom.Logger().Errorf("[Freedom] The retry policy of an unlistened topic, topic:%s", topic)
+			continue
+		}
+		for _, retry := range policy.RetryTopics {
+			c.topicPath[retry.Topic] = path
+			if mode, ok := c.topicMode[topic]; ok {
+				c.topicMode[retry.Topic] = mode
+			}
+			c.retryOrigin[retry.Topic] = topic
+		}
+	}
+}
+
+// policyOf returns the retry policy of the topic of the message, the original
+// topic and the round of the retry topic, 0 for the original topic.
+func (c *ConsumerImpl) policyOf(msg *sarama.ConsumerMessage) (policy *RetryPolicy, topic string, round int) {
+	topic = msg.Topic
+	if origin, ok := c.retryOrigin[msg.Topic]; ok {
+		topic = origin
+	}
+	policy = c.retryPolicies[topic]
+	if policy == nil {
+		return
+	}
+	for index, retry := range policy.RetryTopics {
+		if retry.Topic == msg.Topic {
+			round = index + 1
+			break
+		}
+	}
+	return
+}
+
+// retryDelay returns the time to wait before the message of a retry topic is due.
+// The claim waits for it before the message is dispatched, so the workers are
+// not held by the delayed messages.
+func (c *ConsumerImpl) retryDelay(msg *sarama.ConsumerMessage) time.Duration {
+	policy, _, round := c.policyOf(msg)
+	if round == 0 {
+		return 0
+	}
+	return time.Until(msg.Timestamp.Add(policy.RetryTopics[round-1].Delay))
+}
+
+// handle processes the message with the retry policy of its topic, it waits
+// between the attempts in place. It returns an error if the message must be
+// delivered again, because it failed and could not be forwarded or dropped.
+// The failed messages of the topics without a retry policy are dropped.
+func (c *ConsumerImpl) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	for attempt := 1; ; attempt++ {
+		backoff, err := c.attempt(ctx, msg, attempt)
+		if backoff == 0 || !sleepContext(ctx, backoff) {
+			return err
+		}
+	}
+}
+
+// attempt processes the message once. If it fails with attempts left in place,
+// backoff is the delay of the next attempt. Otherwise the failed message is
+// forwarded or dropped, and the error is returned if it must be delivered again.
+func (c *ConsumerImpl) attempt(ctx context.Context, msg *sarama.ConsumerMessage, attempt int) (backoff time.Duration, e error) {
+	policy, topic, round := c.policyOf(msg)
+	err := c.process(ctx, msg)
+	if policy == nil {
+		if err != nil && ctx.Err() != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	if err == nil {
+		return 0, nil
+	}
+	if attempt < policy.Attempts {
+		return policy.backoff(attempt), err
+	}
+
+	target := policy.DeadLetterTopic
+	if round < len(policy.RetryTopics) {
+		target = policy.RetryTopics[round].Topic
+	}
+	if target == "" {
+		if !policy.DropAfterRetries {
+			return 0, fmt.Errorf("the message failed without a dead-letter topic: %w", err)
+		}
+		freedom.Logger().Errorf("[Freedom] The message is dropped after the retries, topic:%s, key:%s, error:%v", msg.Topic, string(msg.Key), err)
+		return 0, nil
+	}
+	if ferr := c.forward(msg, topic, target, round+1, err); ferr != nil {
+		freedom.Logger().Errorf("[Freedom] Failed to forward the message, topic:%s, to:%s, key:%s, error:%v", msg.Topic, target, string(msg.Key), ferr)
+		return 0, err
+	}
+	freedom.Logger().Infof("[Freedom] The failed message is forwarded, topic:%s, to:%s, key:%s, error:%v", msg.Topic, target, string(msg.Key), err)
+	return 0, nil
+}
+
+// forward publishes the message with the producer, round is the retry round of the target.
+func (c *ConsumerImpl) forward(msg *sarama.ConsumerMessage, topic, target string, round int, cause error) error {
+	header := make(map[string]interface{}, len(msg.Headers)+6)
+	for _, record := range msg.Headers {
+		key := string(record.Key)
+		//The budget of the request does not apply to the retries
+		if strings.EqualFold(key, freedom.DeadlineHeader) || strings.HasPrefix(strings.ToLower(key), "x-retry-") ||
+			strings.HasPrefix(strings.ToLower(key), "x-original-") || strings.HasPrefix(strings.ToLower(key), "x-fail") {
+			continue
+		}
+		header[key] = string(record.Value)
+	}
+	if _, ok := c.retryOrigin[msg.Topic]; ok {
+		header[OriginalPartitionHeader] = consumerHeader(msg, OriginalPartitionHeader)
+		header[OriginalOffsetHeader] = consumerHeader(msg, OriginalOffsetHeader)
+	} else {
+		header[OriginalPartitionHeader] = strconv.Itoa(int(msg.Partition))
+		header[OriginalOffsetHeader] = strconv.FormatInt(msg.Offset, 10)
+	}
+	header[OriginalTopicHeader] = topic
+	header[RetryRoundHeader] = strconv.Itoa(round)
+	header[FailureReasonHeader] = cause.Error()
+	header[FailedAtHeader] = time.Now().Format(time.RFC3339)
+
+	return producer.NewMsg(target, msg.Value).SetMessageKey(string(msg.Key)).SetHeader(header).Publish()
+}
+
+// consumerHeader returns the value of the header of the message.
+func consumerHeader(msg *sarama.ConsumerMessage, key string) string {
+	for _, record := range msg.Headers {
+		if strings.EqualFold(string(record.Key), key) {
+			return string(record.Value)
+		}
+	}
+	return ""
+}
+
+// sleepContext waits for d and returns false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/IBM/sarama"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	configured := &RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	policy := configured.normalized()
+	if policy.Attempts != 1 || configured.Attempts != 0 {
+		t.Fatalf("Attempts = %d, the configured policy must not change", policy.Attempts)
+	}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 64: 5 * time.Second} {
+		if got := policy.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	if policy := (RetryPolicy{Backoff: time.Minute}).normalized(); policy.backoff(1) != time.Minute || policy.backoff(2) != time.Minute {
+		t.Fatalf("the backoff over the default MaxBackoff = %v, want 1m", policy.backoff(1))
+	}
+
+	c := &ConsumerImpl{
+		topicPath: map[string]string{"orders": "/orders/paid"},
+		topicMode: map[string]freedom.EventMode{"orders": freedom.EventKeyOrdered},
+		retryPolicies: map[string]*RetryPolicy{
+			"orders":  {RetryTopics: []RetryTopic{{Topic: "orders.retry.1"}, {Topic: "orders.retry.2"}}},
+			"unknown": {RetryTopics: []RetryTopic{{Topic: "unknown.retry"}}},
+		},
+	}
+	c.initRetryTopics()
+	if c.topicPath["orders.retry.2"] != "/orders/paid" || c.topicMode["orders.retry.1"] != freedom.EventKeyOrdered || c.retryOrigin["orders.retry.1"] != "orders" {
+		t.Fatalf("topicPath = %v, topicMode = %v, retryOrigin = %v", c.topicPath, c.topicMode, c.retryOrigin)
+	}
+	if _, ok := c.topicPath["unknown.retry"]; ok {
+		t.Fatal("the retry topic of an unlistened topic is listened")
+	}
+
+	msg := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{{Key: []byte("X-Retry-Round"), Value: []byte("2")}}}
+	if consumerHeader(msg, RetryRoundHeader) != "2" {
+		t.Fatal("the header is not found")
+	}
+}
+
+func TestRetryDrop(t *testing.T) {
+	defer func() {
+		consumerMiddlewares = nil
+	}()
+	errFailed := errors.New("failed")
+	InstallConsumerMiddleware(func(msg *ConsumerMsg) {
+		msg.Fail(errFailed)
+	})
+
+	c := &ConsumerImpl{
+		retryPolicies: map[string]*RetryPolicy{
+			"orders":   {},
+			"payments": {DropAfterRetries: true},
+		},
+	}
+	for topic, policy := range c.retryPolicies {
+		c.retryPolicies[topic] = policy.normalized()
+	}
+	handle := func(topic string) error {
+		return c.handle(context.Background(), &sarama.ConsumerMessage{Topic: topic})
+	}
+	if err := handle("orders"); !errors.Is(err, errFailed) {
+		t.Fatalf("the failed message without a dead-letter topic is not delivered again, error:%v", err)
+	}
+	if err := handle("payments"); err != nil {
+		t.Fatalf("the failed message is not dropped, error:%v", err)
+	}
+	if err := handle("events"); err != nil {
+		t.Fatalf("the failed message of a topic without a retry policy is not dropped, error:%v", err)
+	}
+}
+
+type testSyncProducer struct {
+	sarama.SyncProducer
+	err  error
+	sent []*sarama.ProducerMessage
+}
+
+func (p *testSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if p.err != nil {
+		return 0, 0, p.err
+	}
+	p.sent = append(p.sent, msg)
+	return 0, 0, nil
+}
+
+// consumed returns the sent message as it is consumed from the target topic.
+func (p *testSyncProducer) consumed() *sarama.ConsumerMessage {
+	sent := p.sent[len(p.sent)-1]
+	msg := &sarama.ConsumerMessage{Topic: sent.Topic, Timestamp: sent.Timestamp}
+	for _, header := range sent.Headers {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: header.Key, Value: header.Value})
+	}
+	return msg
+}
+
+func TestRetryForward(t *testing.T) {
+	defer func(syncProducer sarama.SyncProducer) {
+		consumerMiddlewares = nil
+		producer.syncProducer = syncProducer
+	}(producer.syncProducer)
+	InstallConsumerMiddleware(func(msg *ConsumerMsg) {
+		msg.Fail(errors.New("failed"))
+	})
+	sync := new(testSyncProducer)
+	producer.syncProducer = sync
+
+	c := &ConsumerImpl{
+		topicPath: map[string]string{"orders": "/orders/paid"},
+		retryPolicies: map[string]*RetryPolicy{
+			"orders": (&RetryPolicy{Attempts: 2, Backoff: time.Second, RetryTopics: []RetryTopic{{Topic: "orders.retry.1", Delay: time.Hour}}, DeadLetterTopic: "orders.dlt"}).normalized(),
+		},
+	}
+	c.initRetryTopics()
+	ctx := context.Background()
+	msg := &sarama.ConsumerMessage{Topic: "orders", Partition: 2, Offset: 7, Headers: []*sarama.RecordHeader{{Key: []byte("x-tenant"), Value: []byte("1")}}}
+
+	if backoff, err := c.attempt(ctx, msg, 1); backoff != time.Second || err == nil {
+		t.Fatalf("the first attempt must be retried in place, backoff:%v, error:%v", backoff, err)
+	}
+	if _, err := c.attempt(ctx, msg, 2); err != nil || len(sync.sent) != 1 || sync.sent[0].Topic != "orders.retry.1" {
+		t.Fatalf("the message must be forwarded to the retry topic, error:%v", err)
+	}
+	retry := sync.consumed()
+	if consumerHeader(retry, RetryRoundHeader) != "1" || consumerHeader(retry, OriginalTopicHeader) != "orders" ||
+		consumerHeader(retry, OriginalPartitionHeader) != "2" || consumerHeader(retry, OriginalOffsetHeader) != "7" ||
+		consumerHeader(retry, FailureReasonHeader) != "failed" || consumerHeader(retry, "x-tenant") != "1" {
+		t.Fatalf("the headers of the retry are %v", retry.Headers)
+	}
+	if delay := c.retryDelay(retry); delay < 59*time.Minute || c.retryDelay(msg) != 0 {
+		t.Fatalf("the retry must wait for its delay, delay:%v", delay)
+	}
+
+	retry.Partition, retry.Offset = 0, 3
+	if _, err := c.attempt(ctx, retry, 2); err != nil || len(sync.sent) != 2 || sync.sent[1].Topic != "orders.dlt" {
+		t.Fatalf("the message must be forwarded to the dead-letter topic, error:%v", err)
+	}
+	dead := sync.consumed()
+	if consumerHeader(dead, RetryRoundHeader) != "2" || consumerHeader(dead, OriginalTopicHeader) != "orders" ||
+		consumerHeader(dead, OriginalPartitionHeader) != "2" || consumerHeader(dead, OriginalOffsetHeader) != "7" {
+		t.Fatalf("the headers of the dead letter are %v", dead.Headers)
+	}
+
+	sync.err = errors.New("broker down")
+	if _, err := c.attempt(ctx, msg, 2); err == nil {
+		t.Fatal("the message that cannot be forwarded must be delivered again")
+	}
+}
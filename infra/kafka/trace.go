@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the consumer spans.
+// The spans are not recorded until a TracerProvider is installed, see infra/tracing.
+const tracerName = "github.com/8treenet/freedom/infra/kafka"
+
+// recordHeaders adapts the headers of a consumed message to propagation.TextMapCarrier.
+type recordHeaders []*sarama.RecordHeader
+
+func (headers recordHeaders) Get(key string) string {
+	for _, header := range headers {
+		if strings.EqualFold(string(header.Key), key) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (headers recordHeaders) Set(key, value string) {}
+
+func (headers recordHeaders) Keys() []string {
+	keys := make([]string, 0, len(headers))
+	for _, header := range headers {
+		keys = append(keys, string(header.Key))
+	}
+	return keys
+}
+
+// startConsumerSpan starts the span of the message, the parent is the span of the producer.
+func startConsumerSpan(ctx context.Context, msg *sarama.ConsumerMessage) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, recordHeaders(msg.Headers))
+	return otel.Tracer(tracerName).Start(ctx, "process "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.String("messaging.kafka.message.key", string(msg.Key)),
+			attribute.Int("messaging.destination.partition.id", int(msg.Partition)),
+			attribute.Int64("messaging.kafka.offset", msg.Offset),
+		))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
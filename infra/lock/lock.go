@@ -0,0 +1,238 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultTTL The time to live of the lock of WithLock.
+const DefaultTTL = 30 * time.Second
+
+// keyPrefix The prefix of the redis keys of the locks.
+const keyPrefix = "lock:"
+
+var (
+	// ErrNotAcquired The lock is held by another owner.
+	ErrNotAcquired = errors.New("lock: not acquired")
+	// ErrNotHeld The lock has expired or is held by another owner.
+	ErrNotHeld = errors.New("lock: not held")
+)
+
+// Locker The distributed lock component.
+// The lock is a redis key that holds the token of the owner, only the owner
+// can extend or release it.
+type Locker interface {
+	// Lock Acquires the lock, waits until it is released or ctx is done.
+	Lock(ctx context.Context, key string, ttl time.Duration) (*Lease, error)
+	// TryLock Acquires the lock if it is free, otherwise returns ErrNotAcquired.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (*Lease, error)
+	// Unlock Releases the lock of the lease, ErrNotHeld if the lease has been lost.
+	Unlock(ctx context.Context, lease *Lease) error
+	// WithLock Runs fun while holding the lock, the lock is waited with
+	// Worker.Context(). fun is called with a context that keeps the values of
+	// Worker.Context() and is done if the request is canceled or the lock is lost.
+	// The optional ttl is DefaultTTL by default.
+	WithLock(key string, fun func(ctx context.Context) error, ttl ...time.Duration) error
+}
+
+var _ Locker = (*LockerImpl)(nil)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindInfra(false, func() *LockerImpl {
+			return &LockerImpl{}
+		})
+	})
+}
+
+var (
+	extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+	unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// LockerImpl .
+type LockerImpl struct {
+	freedom.Infra
+}
+
+// Lock Acquires the lock, waits until it is released or ctx is done.
+func (locker *LockerImpl) Lock(ctx context.Context, key string, ttl time.Duration) (*Lease, error) {
+	backoff := 20 * time.Millisecond
+	for {
+		lease, err := locker.TryLock(ctx, key, ttl)
+		if !errors.Is(err, ErrNotAcquired) {
+			return lease, err
+		}
+
+		timer := time.NewTimer(backoff/2 + rand.N(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if backoff < time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// TryLock Acquires the lock if it is free, otherwise returns ErrNotAcquired.
+// The lease is extended in the background until it is unlocked.
+func (locker *LockerImpl) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lease, error) {
+	if ttl < 100*time.Millisecond {
+		return nil, errors.New("lock: the ttl must be at least 100ms")
+	}
+	client := locker.Redis()
+	if client == nil {
+		return nil, errors.New("lock: the redis is not installed")
+	}
+	return tryLock(ctx, client, key, ttl)
+}
+
+func tryLock(ctx context.Context, client redis.Cmdable, key string, ttl time.Duration) (*Lease, error) {
+	token := strings.ReplaceAll(uuid.New().String(), "-", "")
+	ok, err := client.SetNX(ctx, keyPrefix+key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotAcquired
+	}
+	lease := newLease(ctx, client, keyPrefix+key, token, ttl)
+	go lease.keepAlive()
+	return lease, nil
+}
+
+// Unlock Releases the lock of the lease, ErrNotHeld if the lease has been lost.
+func (locker *LockerImpl) Unlock(ctx context.Context, lease *Lease) error {
+	return lease.release(ctx)
+}
+
+// WithLock Runs fun while holding the lock, the lock is waited with
+// Worker.Context(). fun is called with a context that keeps the values of
+// Worker.Context() and is done when the request is canceled or the lease is
+// lost, fun should stop then. If the lease is lost while fun runs, ErrNotHeld
+// is returned with the error of fun.
+func (locker *LockerImpl) WithLock(key string, fun func(ctx context.Context) error, ttl ...time.Duration) error {
+	leaseTTL := DefaultTTL
+	if len(ttl) > 0 {
+		leaseTTL = ttl[0]
+	}
+	ctx := context.Background()
+	if worker := locker.Worker(); worker != nil {
+		ctx = worker.Context()
+	}
+
+	lease, err := locker.Lock(ctx, key, leaseTTL)
+	if err != nil {
+		return err
+	}
+	return withLease(ctx, lease, fun)
+}
+
+// withLease runs fun with ctx canceled when the lease is lost, then releases the lease.
+func withLease(ctx context.Context, lease *Lease, fun func(ctx context.Context) error) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(lease.Context(), cancel)
+	err := fun(runCtx)
+	stop()
+	cancel()
+	//The lock is released even if the request has ended
+	return errors.Join(err, lease.release(context.WithoutCancel(ctx)))
+}
+
+// Lease The lock held by the owner token.
+type Lease struct {
+	// Key is the redis key of the lock.
+	Key string
+	// Token of the owner, it is the value of the key.
+	Token string
+
+	client redis.Cmdable
+	ttl    time.Duration
+	ctx    context.Context
+	lost   context.CancelFunc
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// newLease returns a lease whose context keeps the values of ctx, not its cancellation.
+func newLease(ctx context.Context, client redis.Cmdable, key, token string, ttl time.Duration) *Lease {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &Lease{Key: key, Token: token, client: client, ttl: ttl, ctx: ctx, lost: cancel, stop: make(chan struct{})}
+}
+
+// Context Returns a context that is done when the lease is lost or released.
+func (lease *Lease) Context() context.Context {
+	return lease.ctx
+}
+
+// keepAlive extends the lease every third of the ttl until it is released.
+// The lease is lost if it cannot be extended before it expires.
+func (lease *Lease) keepAlive() {
+	interval := lease.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	expires := time.Now().Add(lease.ttl)
+	for {
+		select {
+		case <-lease.stop:
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(lease.ctx, interval)
+		extended, err := extendScript.Run(ctx, lease.client, []string{lease.Key}, lease.Token, lease.ttl.Milliseconds()).Int64()
+		cancel()
+		switch {
+		case err == nil && extended == 1:
+			expires = start.Add(lease.ttl)
+		case err == nil || !time.Now().Add(interval).Before(expires):
+			if err != nil {
+				freedom.Logger().Errorf("[Freedom] Failed to extend the lock, key:%s, error:%v", lease.Key, err)
+			}
+			freedom.Logger().Errorf("[Freedom] The lock is lost, key:%s", lease.Key)
+			lease.lost()
+			return
+		}
+	}
+}
+
+func (lease *Lease) release(ctx context.Context) (e error) {
+	e = ErrNotHeld
+	lease.once.Do(func() {
+		close(lease.stop)
+		lost := lease.ctx.Err() != nil
+		lease.lost()
+		if lost {
+			return
+		}
+		deleted, err := unlockScript.Run(ctx, lease.client, []string{lease.Key}, lease.Token).Int64()
+		switch {
+		case err != nil:
+			e = err
+		case deleted == 1:
+			e = nil
+		}
+	})
+	return
+}
@@ -0,0 +1,173 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testRedis returns the local redis, or an in-process miniredis without it.
+// The clock of miniredis follows the wall clock so that the keys expire.
+func testRedis(t *testing.T) redis.Cmdable {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", MaxRetries: -1, DialerRetries: 1})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		server := miniredis.RunT(t)
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					server.FastForward(10 * time.Millisecond)
+				}
+			}
+		}()
+		t.Cleanup(func() {
+			close(done)
+		})
+		client = redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	}
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return client
+}
+
+func testKey() string {
+	return fmt.Sprintf("test:%d", time.Now().UnixNano())
+}
+
+func TestTryLock(t *testing.T) {
+	client := testRedis(t)
+	ctx := context.Background()
+	key := testKey()
+	defer client.Del(ctx, keyPrefix+key)
+
+	lease, err := tryLock(ctx, client, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tryLock(ctx, client, key, time.Second); !errors.Is(err, ErrNotAcquired) {
+		t.Fatal("the lock must not be acquired twice", err)
+	}
+
+	if err := lease.release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lease.Context().Err() == nil {
+		t.Fatal("the context of a released lease must be done")
+	}
+	other, err := tryLock(ctx, client, key, time.Second)
+	if err != nil {
+		t.Fatal("the released lock must be acquired", err)
+	}
+	other.release(ctx)
+}
+
+func TestUnlockNotOwner(t *testing.T) {
+	client := testRedis(t)
+	ctx := context.Background()
+	key := testKey()
+	defer client.Del(ctx, keyPrefix+key)
+
+	lease, err := tryLock(ctx, client, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.release(ctx)
+
+	other := newLease(ctx, client, lease.Key, "other", time.Second)
+	if err := other.release(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Fatal("a non-owner must not release the lock", err)
+	}
+	if token, _ := client.Get(ctx, lease.Key).Result(); token != lease.Token {
+		t.Fatal("the lock must still be held by the owner", token)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	client := testRedis(t)
+	ctx := context.Background()
+	key := testKey()
+	defer client.Del(ctx, keyPrefix+key)
+
+	lease, err := tryLock(ctx, client, key, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The lease is extended beyond its first expiry
+	time.Sleep(600 * time.Millisecond)
+	if lease.Context().Err() != nil {
+		t.Fatal("the lease must be extended")
+	}
+	if ttl := client.PTTL(ctx, lease.Key).Val(); ttl <= 0 {
+		t.Fatal("the lock must not expire while it is held", ttl)
+	}
+
+	//Another owner took the lock, the lease is lost
+	client.Set(ctx, lease.Key, "other", time.Second)
+	select {
+	case <-lease.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("the lease must be lost")
+	}
+	if err := lease.release(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Fatal("a lost lease must not be released", err)
+	}
+	if token, _ := client.Get(ctx, lease.Key).Result(); token != "other" {
+		t.Fatal("the lock of the other owner must be kept", token)
+	}
+}
+
+func TestWithLease(t *testing.T) {
+	client := testRedis(t)
+	type valueKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), valueKey{}, "request"))
+	key := testKey()
+	defer client.Del(context.Background(), keyPrefix+key)
+
+	lease, err := tryLock(ctx, client, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = withLease(ctx, lease, func(ctx context.Context) error {
+		if ctx.Value(valueKey{}) != "request" {
+			t.Error("the context must keep the values of the request")
+		}
+		cancel()
+		if ctx.Err() == nil {
+			t.Error("the context must be done when the request is canceled")
+		}
+		return nil
+	})
+	if err != nil || lease.Context().Err() == nil {
+		t.Fatal("the lease must be released after the request is canceled", err)
+	}
+
+	lease, err = tryLock(context.Background(), client, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = withLease(context.Background(), lease, func(ctx context.Context) error {
+		//Another owner took the lock, the lease is lost
+		client.Set(context.Background(), lease.Key, "other", time.Second)
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+			t.Error("the context must be done when the lease is lost")
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrNotHeld) {
+		t.Fatal("the lost lease must be reported", err)
+	}
+}
@@ -0,0 +1,62 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/8treenet/freedom"
+	"github.com/8treenet/freedom/infra/kafka"
+)
+
+// NewKafkaPublisher Returns a publisher that sends the events with the producer.
+// The topic of the message is the topic of the event, the key is the identity of
+// the event unless the event has a MessageKey() string method. The relayed events
+// have the key stored by Outbox.Save. The identity is sent in freedom.EventIDHeader.
+// The messages are sent without a deadline, the consumers do not inherit the
+// publish timeout of the relay.
+func NewKafkaPublisher(producer kafka.Producer) Publisher {
+	return &kafkaPublisher{producer: producer}
+}
+
+type kafkaPublisher struct {
+	producer kafka.Producer
+}
+
+// Publish .
+func (p *kafkaPublisher) Publish(ctx context.Context, events ...freedom.DomainEvent) error {
+	for _, event := range events {
+		content, err := event.Marshal()
+		if err != nil {
+			return err
+		}
+		key := event.Identity()
+		if keyer, ok := event.(interface{ MessageKey() string }); ok {
+			key = keyer.MessageKey()
+		}
+
+		header := make(map[string]interface{}, len(event.GetPrototypes())+1)
+		for name, value := range event.GetPrototypes() {
+			header[name] = value
+		}
+		header[freedom.EventIDHeader] = event.Identity()
+		//The deadline of ctx bounds the send, it is not sent as the deadline of the message
+		msg := p.producer.NewMsg(event.Topic(), content).SetMessageKey(key).SetHeader(header).WithContext(context.WithoutCancel(ctx))
+		if err := send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send publishes the message, it returns when ctx is done.
+func send(ctx context.Context, msg *kafka.Msg) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- msg.Publish()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,446 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/8treenet/freedom/infra/transaction"
+	"gorm.io/gorm"
+)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindInfra(true, outbox)
+	})
+}
+
+var outbox = &Outbox{wake: make(chan struct{}, 1)}
+
+// GetOutbox Gets the transactional outbox.
+func GetOutbox() *Outbox {
+	return outbox
+}
+
+// The status of a message in the outbox.
+const (
+	StatusPending   = 0
+	StatusDelivered = 1
+	StatusDead      = 2
+)
+
+// Publisher Publishes the events relayed from the outbox.
+// The dispatcher of infra/dispatcher is a Publisher, see NewKafkaPublisher for kafka.
+type Publisher interface {
+	Publish(ctx context.Context, events ...freedom.DomainEvent) error
+}
+
+// Config The configuration of the outbox.
+type Config struct {
+	// Publisher of the relayed events, required.
+	Publisher Publisher
+	// Table of the messages, "freedom_outbox" by default. It is migrated when the application boots.
+	Table string
+	// DataSource is the name of the installed database, the default database by default.
+	// The transaction of the repository must be opened on it, see ExecuteNamed.
+	DataSource string
+	// LeaderOnly relays the messages on the leader only, see infra/election.
+	// Otherwise every instance relays and a message is claimed before it is published.
+	LeaderOnly bool
+	// RelayInterval is the interval to scan the pending messages, 1s by default.
+	RelayInterval time.Duration
+	// BatchSize is the number of the messages relayed by a scan, 100 by default.
+	BatchSize int
+	// PublishTimeout of a message, 30s by default. A claimed message that is not
+	// published in time is relayed again.
+	PublishTimeout time.Duration
+	// MaxAttempts to publish a message, 10 by default. The message is dead after the last attempt.
+	MaxAttempts int
+	// RetryBackoff is the delay of the first retry, 1s by default. It doubles with every retry.
+	RetryBackoff time.Duration
+	// MaxRetryBackoff is the longest delay of a retry, 10m by default.
+	MaxRetryBackoff time.Duration
+	// Retention of the delivered messages, 24h by default. The dead messages are kept.
+	Retention time.Duration
+}
+
+// Install Enables the outbox.
+// The messages are relayed from OnReady to OnDrain.
+func Install(conf Config) {
+	if conf.Publisher == nil {
+		panic("[Freedom] The outbox requires a publisher")
+	}
+	if conf.Table == "" {
+		conf.Table = "freedom_outbox"
+	}
+	if conf.RelayInterval <= 0 {
+		conf.RelayInterval = time.Second
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 100
+	}
+	if conf.PublishTimeout <= 0 {
+		conf.PublishTimeout = 30 * time.Second
+	}
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 10
+	}
+	if conf.RetryBackoff <= 0 {
+		conf.RetryBackoff = time.Second
+	}
+	if conf.MaxRetryBackoff < conf.RetryBackoff {
+		conf.MaxRetryBackoff = 10 * time.Minute
+	}
+	if conf.Retention <= 0 {
+		conf.Retention = 24 * time.Hour
+	}
+	outbox.conf = conf
+	outbox.installed = true
+}
+
+// Message The row of an event in the outbox.
+type Message struct {
+	ID          uint64    `gorm:"primaryKey;autoIncrement"`
+	Identity    string    `gorm:"size:64;uniqueIndex;not null"`
+	Topic       string    `gorm:"size:255;not null"`
+	MessageKey  string    `gorm:"size:255"`
+	Content     string    `gorm:"type:text;not null"`
+	Header      string    `gorm:"type:text"`
+	Status      int       `gorm:"index:idx_outbox_relay,priority:1;not null;default:0"`
+	NextAttempt time.Time `gorm:"index:idx_outbox_relay,priority:2;not null"`
+	Attempts    int       `gorm:"not null;default:0"`
+	LastError   string    `gorm:"size:1024"`
+	Created     time.Time `gorm:"not null"`
+	Updated     time.Time `gorm:"not null"`
+}
+
+// Event Returns the event of the message, the content is not decoded.
+func (msg *Message) Event() (freedom.DomainEvent, error) {
+	event := &Event{topic: msg.Topic, identity: msg.Identity, key: msg.MessageKey, content: []byte(msg.Content)}
+	if msg.Header != "" {
+		if err := json.Unmarshal([]byte(msg.Header), &event.prototypes); err != nil {
+			return nil, fmt.Errorf("invalid header of the outbox message %s: %w", msg.Identity, err)
+		}
+	}
+	return event, nil
+}
+
+// Event The relayed event, Marshal returns the stored content.
+// The dispatcher decodes it into the type of the handler.
+type Event struct {
+	topic      string
+	identity   string
+	key        string
+	content    []byte
+	prototypes map[string]interface{}
+}
+
+// Topic .
+func (e *Event) Topic() string { return e.topic }
+
+// SetPrototypes .
+func (e *Event) SetPrototypes(prototypes map[string]interface{}) { e.prototypes = prototypes }
+
+// GetPrototypes .
+func (e *Event) GetPrototypes() map[string]interface{} { return e.prototypes }
+
+// Marshal .
+func (e *Event) Marshal() ([]byte, error) { return e.content, nil }
+
+// Unmarshal .
+func (e *Event) Unmarshal(content []byte) error {
+	e.content = content
+	return nil
+}
+
+// Identity .
+func (e *Event) Identity() string { return e.identity }
+
+// SetIdentity .
+func (e *Event) SetIdentity(identity string) { e.identity = identity }
+
+// MessageKey Returns the message key stored with the event, the identity if there is none.
+func (e *Event) MessageKey() string {
+	if e.key == "" {
+		return e.identity
+	}
+	return e.key
+}
+
+// Outbox The transactional outbox.
+// The pub events of an entity are stored in the transaction of the repository
+// and relayed to the publisher after the commit, at least once.
+type Outbox struct {
+	freedom.Infra
+	conf      Config
+	installed bool
+	wake      chan struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Booting The method of overriding the component .
+// The single-case component initiates a callback.
+func (o *Outbox) Booting(bootManager freedom.BootManager) {
+	if !o.installed {
+		return
+	}
+	db, err := o.db()
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Table(o.conf.Table).AutoMigrate(&Message{}); err != nil {
+		panic(fmt.Sprintf("[Freedom] Failed to migrate the outbox, %v", err))
+	}
+
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "outbox",
+		Phase: freedom.OnReady,
+		Func: func(ctx context.Context) error {
+			o.start()
+			return nil
+		},
+	})
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "outbox",
+		Phase: freedom.OnDrain,
+		Func:  o.stop,
+	})
+}
+
+// WorkerGetter Gets the Worker of the request, the repositories and the infras are WorkerGetters.
+type WorkerGetter interface {
+	Worker() freedom.Worker
+}
+
+// Save Stores the pub events of the entity with the DB of the Worker of the
+// repository, in its transaction if there is one. The events are removed from the entity and
+// relayed after the commit, their prototypes are set from the Bus of the Worker.
+// The message key is the identity of the event unless the event has a
+// MessageKey() string method, it is stored with the event.
+func (o *Outbox) Save(repo WorkerGetter, entity freedom.Entity) error {
+	events := entity.GetPubEvents()
+	if len(events) == 0 {
+		return nil
+	}
+	if !o.installed {
+		return errors.New("[Freedom] The outbox is not installed")
+	}
+	worker := repo.Worker()
+	var db *gorm.DB
+	if err := freedom.FetchNamedDB(worker, o.conf.DataSource, &db); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	messages := make([]*Message, 0, len(events))
+	freedom.SetEventPrototypes(worker, events...)
+	for _, event := range events {
+		content, err := event.Marshal()
+		if err != nil {
+			return err
+		}
+		header, err := json.Marshal(event.GetPrototypes())
+		if err != nil {
+			return err
+		}
+		key := event.Identity()
+		if keyer, ok := event.(interface{ MessageKey() string }); ok {
+			key = keyer.MessageKey()
+		}
+		messages = append(messages, &Message{
+			Identity:    event.Identity(),
+			Topic:       event.Topic(),
+			MessageKey:  key,
+			Content:     string(content),
+			Header:      string(header),
+			NextAttempt: now,
+			Created:     now,
+			Updated:     now,
+		})
+	}
+	if err := db.Table(o.conf.Table).Create(&messages).Error; err != nil {
+		return err
+	}
+	entity.RemoveAllPubEvent()
+	transaction.AfterCommit(worker, o.notify, o.conf.DataSource)
+	return nil
+}
+
+// notify wakes up the relay.
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) db() (*gorm.DB, error) {
+	var db *gorm.DB
+	if err := o.FetchOnlyNamedDB(o.conf.DataSource, &db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (o *Outbox) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.done = make(chan struct{})
+	go func() {
+		defer close(o.done)
+		o.loop(ctx)
+	}()
+}
+
+// stop stops the relay and waits for the messages being published.
+func (o *Outbox) stop(ctx context.Context) error {
+	if o.cancel == nil {
+		return nil
+	}
+	o.cancel()
+	select {
+	case <-o.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the outbox relay did not finish: %w", ctx.Err())
+	}
+}
+
+func (o *Outbox) loop(ctx context.Context) {
+	ticker := time.NewTicker(o.conf.RelayInterval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+		if o.conf.LeaderOnly && !freedom.IsLeader() {
+			continue
+		}
+
+		for ctx.Err() == nil {
+			relayed, err := o.relay(ctx)
+			if err != nil {
+				freedom.Logger().Errorf("[Freedom] Failed to relay the outbox, error:%v", err)
+			}
+			if err != nil || relayed < o.conf.BatchSize {
+				break
+			}
+		}
+		if time.Since(pruned) > time.Hour {
+			pruned = time.Now()
+			if err := o.prune(ctx); err != nil {
+				freedom.Logger().Errorf("[Freedom] Failed to prune the outbox, error:%v", err)
+			}
+		}
+	}
+}
+
+// relay publishes a batch of the pending messages in the order of insertion and
+// returns the number of the messages scanned. A failed message is retried with
+// an exponential backoff and does not block the messages after it.
+func (o *Outbox) relay(ctx context.Context) (int, error) {
+	db, err := o.db()
+	if err != nil {
+		return 0, err
+	}
+	var messages []*Message
+	err = db.WithContext(ctx).Table(o.conf.Table).
+		Where("status = ? AND next_attempt <= ?", StatusPending, time.Now()).
+		Order("id ASC").Limit(o.conf.BatchSize).Find(&messages).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		//The message is claimed until the publish timeout, the other instances skip it
+		claim := db.WithContext(ctx).Table(o.conf.Table).
+			Where("id = ? AND status = ? AND next_attempt = ?", msg.ID, StatusPending, msg.NextAttempt).
+			Updates(map[string]interface{}{"next_attempt": time.Now().Add(o.conf.PublishTimeout)})
+		if claim.Error != nil {
+			return len(messages), claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		o.publish(ctx, db, msg)
+	}
+	return len(messages), nil
+}
+
+func (o *Outbox) publish(ctx context.Context, db *gorm.DB, msg *Message) {
+	//A message that cannot be decoded is dead, the retries would fail the same way
+	event, err := msg.Event()
+	attempts := o.conf.MaxAttempts
+	if err == nil {
+		publishCtx, cancel := context.WithTimeout(ctx, o.conf.PublishTimeout)
+		err = o.conf.Publisher.Publish(publishCtx, event)
+		cancel()
+		attempts = msg.Attempts + 1
+	}
+
+	now := time.Now()
+	changes := map[string]interface{}{"status": StatusDelivered, "attempts": msg.Attempts + 1, "updated": now}
+	if err != nil {
+		lastError := err.Error()
+		if len(lastError) > 1024 {
+			lastError = lastError[:1024]
+		}
+		changes["status"] = StatusPending
+		changes["last_error"] = lastError
+		changes["next_attempt"] = now.Add(o.backoff(msg.Attempts + 1))
+		if attempts >= o.conf.MaxAttempts {
+			changes["status"] = StatusDead
+			freedom.Logger().Errorf("[Freedom] The outbox message is dead, topic:%s, id:%s, error:%v", msg.Topic, msg.Identity, err)
+		}
+	}
+	//The result is recorded even if the relay is stopping
+	result := db.WithContext(context.WithoutCancel(ctx)).Table(o.conf.Table).Where("id = ?", msg.ID).Updates(changes)
+	if result.Error != nil {
+		freedom.Logger().Errorf("[Freedom] Failed to update the outbox message, id:%s, error:%v", msg.Identity, result.Error)
+	}
+}
+
+// prune deletes the delivered messages older than the retention.
+func (o *Outbox) prune(ctx context.Context) error {
+	db, err := o.db()
+	if err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		var ids []uint64
+		err := db.WithContext(ctx).Table(o.conf.Table).
+			Where("status = ? AND updated < ?", StatusDelivered, time.Now().Add(-o.conf.Retention)).
+			Order("id ASC").Limit(1000).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := db.WithContext(ctx).Table(o.conf.Table).Where("id IN ?", ids).Delete(&Message{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff returns the delay of the retry after the attempt, with a jitter in [d/2, d].
+func (o *Outbox) backoff(attempt int) time.Duration {
+	d := o.conf.MaxRetryBackoff
+	if attempt < 32 {
+		if shifted := o.conf.RetryBackoff << (attempt - 1); shifted > 0 && shifted < d {
+			d = shifted
+		}
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,52 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/8treenet/freedom/infra/dispatcher"
+)
+
+var _ Publisher = dispatcher.GetDispatcher()
+
+func TestMessageEvent(t *testing.T) {
+	msg := &Message{Identity: "1", Topic: "order-paid", Content: `{"orderId":7}`, Header: `{"x-request-id":"abc"}`}
+	event, err := msg.Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := event.Marshal()
+	if event.Topic() != "order-paid" || event.Identity() != "1" || string(content) != msg.Content {
+		t.Fatalf("event = %+v", event)
+	}
+	if event.GetPrototypes()["x-request-id"] != "abc" {
+		t.Fatalf("prototypes = %v", event.GetPrototypes())
+	}
+	if key := event.(*Event).MessageKey(); key != "1" {
+		t.Fatalf("the key of a message without a key = %s, want the identity", key)
+	}
+
+	msg.MessageKey = "order-7"
+	if event, _ = msg.Event(); event.(*Event).MessageKey() != "order-7" {
+		t.Fatalf("the stored key = %s, want order-7", event.(*Event).MessageKey())
+	}
+
+	msg.Header = `{"x-request-id":`
+	if _, err := msg.Event(); err == nil {
+		t.Fatal("a corrupt header must fail the event")
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	o := &Outbox{conf: Config{RetryBackoff: time.Second, MaxRetryBackoff: time.Minute}}
+	for _, tc := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, time.Second}, {3, 4 * time.Second}, {10, time.Minute},
+	} {
+		if d := o.backoff(tc.attempt); d < tc.max/2 || d > tc.max {
+			t.Errorf("backoff(%d) = %v, want [%v, %v]", tc.attempt, d, tc.max/2, tc.max)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/8treenet/freedom"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindInfra(true, queue)
+	})
+}
+
+var queue = &Queue{handlers: make(map[string]reflect.Value)}
+
+// GetQueue Gets the job queue.
+func GetQueue() *Queue {
+	return queue
+}
+
+// The results of the jobs in the metrics.
+const (
+	resultOK       = "ok"
+	resultRetry    = "retry"
+	resultDead     = "dead"
+	resultEnqueued = "enqueued"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	jobPtrType = reflect.TypeOf((*Job)(nil))
+)
+
+// Config The configuration of the job queue.
+type Config struct {
+	// Name of the queue, the keys in redis are prefixed with "queue:{Name}:". "default" by default.
+	Name string
+	// Concurrency is the number of the jobs processed at the same time, 10 by default.
+	Concurrency int
+	// VisibilityTimeout of a job, 1m by default. A job that is not finished in time
+	// is delivered again, Worker.Context() of the handler expires at the timeout.
+	VisibilityTimeout time.Duration
+	// MaxRetries of a failed job, 5 by default. The job is dead after the last retry.
+	MaxRetries int
+	// RetryBackoff is the delay of the first retry, 1s by default. It doubles with every retry.
+	RetryBackoff time.Duration
+	// MaxRetryBackoff is the longest delay of a retry, 10m by default.
+	MaxRetryBackoff time.Duration
+	// PollInterval is the interval to poll redis when the queue is empty, 1s by default.
+	PollInterval time.Duration
+}
+
+// Install Enables the job queue, the jobs are kept in the installed redis.
+// The jobs are processed from OnReady to OnDrain.
+func Install(conf Config) {
+	if conf.Name == "" {
+		conf.Name = "default"
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 10
+	}
+	if conf.VisibilityTimeout <= 0 {
+		conf.VisibilityTimeout = time.Minute
+	}
+	if conf.MaxRetries < 0 {
+		conf.MaxRetries = 0
+	} else if conf.MaxRetries == 0 {
+		conf.MaxRetries = 5
+	}
+	if conf.RetryBackoff <= 0 {
+		conf.RetryBackoff = time.Second
+	}
+	if conf.MaxRetryBackoff < conf.RetryBackoff {
+		conf.MaxRetryBackoff = 10 * time.Minute
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	queue.conf = conf
+	queue.prefix = "queue:" + conf.Name + ":"
+	queue.installed = true
+}
+
+// Job The job in the queue.
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+	// LastError is the error of the previous attempt.
+	LastError string `json:"last_error,omitempty"`
+	// Attempt is the number of the deliveries of the job, including this one.
+	Attempt int `json:"-"`
+}
+
+// Unmarshal Parses the payload of the job.
+func (job *Job) Unmarshal(v interface{}) error {
+	return json.Unmarshal(job.Payload, v)
+}
+
+// The layout in redis: the jobs are kept in a hash, the ids of the jobs wait in
+// the ready list, the delayed zset by the time to run, or the inflight zset by
+// the visibility deadline. The dead zset is ordered by the time of death.
+var (
+	// fetchScript moves the due delayed jobs and the timed out inflight jobs to
+	// the ready list, then moves a ready job to the inflight zset.
+	fetchScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('LPUSH', KEYS[1], id)
+end
+local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[3], id)
+	redis.call('LPUSH', KEYS[1], id)
+end
+local id = redis.call('RPOP', KEYS[1])
+if not id then
+	return false
+end
+local data = redis.call('HGET', KEYS[4], id)
+if not data then
+	return false
+end
+redis.call('ZADD', KEYS[3], ARGV[2], id)
+local attempt = redis.call('HINCRBY', KEYS[5], id, 1)
+return {id, data, attempt}`)
+
+	ackScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1`)
+
+	// moveScript moves an inflight job to the delayed or the dead zset.
+	moveScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+return 1`)
+
+	retryDeadScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('LPUSH', KEYS[2], ARGV[1])
+return 1`)
+)
+
+// Queue The durable job queue in redis.
+// A job is delivered at least once, the handler runs with a Worker like
+// ServiceLocator().Call and a failed job is retried with an exponential backoff.
+type Queue struct {
+	freedom.Infra
+	conf      Config
+	prefix    string
+	installed bool
+	handlers  map[string]reflect.Value
+	client    redis.Cmdable
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Booting The method of overriding the component .
+// The single-case component initiates a callback.
+func (q *Queue) Booting(bootManager freedom.BootManager) {
+	if !q.installed {
+		return
+	}
+	if q.client = q.Redis(); q.client == nil {
+		panic("[Freedom] The job queue requires the redis, please install")
+	}
+
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "queue",
+		Phase: freedom.OnReady,
+		Func: func(ctx context.Context) error {
+			q.start()
+			return nil
+		},
+	})
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "queue",
+		Phase: freedom.OnDrain,
+		Func:  q.stop,
+	})
+}
+
+// Handle Registers the handler of a job type, the handler is a
+// func(*Service, *queue.Job) error. The service is created like ServiceLocator().Call.
+func (q *Queue) Handle(jobType string, handler interface{}) {
+	ftype := reflect.TypeOf(handler)
+	if ftype == nil || ftype.Kind() != reflect.Func || ftype.NumIn() != 2 || ftype.In(0).Kind() != reflect.Ptr ||
+		ftype.In(1) != jobPtrType || ftype.NumOut() != 1 || ftype.Out(0) != errorType {
+		panic(fmt.Sprintf("[Freedom] The handler of the job '%s' must be a func(*Service, *queue.Job) error", jobType))
+	}
+	q.handlers[jobType] = reflect.ValueOf(handler)
+}
+
+// Enqueue Adds a job, the payload is encoded in JSON unless it is a json.RawMessage.
+// The job runs after the optional delay. It returns the id of the job.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, delay ...time.Duration) (string, error) {
+	if !q.installed {
+		return "", errors.New("[Freedom] The job queue is not installed")
+	}
+	job := Job{ID: strings.ReplaceAll(uuid.New().String(), "-", ""), Type: jobType, EnqueuedAt: time.Now()}
+	if data, ok := payload.(json.RawMessage); ok {
+		job.Payload = data
+	} else {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return "", err
+		}
+		job.Payload = data
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+
+	pipe := q.client.TxPipeline()
+	pipe.HSet(ctx, q.key("jobs"), job.ID, data)
+	if len(delay) > 0 && delay[0] > 0 {
+		pipe.ZAdd(ctx, q.key("delayed"), redis.Z{Score: float64(time.Now().Add(delay[0]).UnixMilli()), Member: job.ID})
+	} else {
+		pipe.LPush(ctx, q.key("ready"), job.ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	freedom.Prometheus().QueueWithLabelValues(q.conf.Name, jobType, resultEnqueued, time.Time{})
+	return job.ID, nil
+}
+
+// DeadJobs Gets the oldest dead jobs, at most limit.
+func (q *Queue) DeadJobs(ctx context.Context, limit int64) ([]*Job, error) {
+	ids, err := q.client.ZRange(ctx, q.key("dead"), 0, limit-1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	values, err := q.client.HMGet(ctx, q.key("jobs"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var result []*Job
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		job := new(Job)
+		if err := json.Unmarshal([]byte(data), job); err != nil {
+			return nil, err
+		}
+		result = append(result, job)
+	}
+	return result, nil
+}
+
+// RetryDead Moves a dead job back to the queue, the attempts start again.
+func (q *Queue) RetryDead(ctx context.Context, id string) error {
+	moved, err := retryDeadScript.Run(ctx, q.client, []string{q.key("dead"), q.key("ready"), q.key("attempts")}, id).Int64()
+	if err != nil {
+		return err
+	}
+	if moved == 0 {
+		return fmt.Errorf("[Freedom] The dead job '%s' is not found", id)
+	}
+	return nil
+}
+
+// DeleteDead Deletes a dead job.
+func (q *Queue) DeleteDead(ctx context.Context, id string) error {
+	pipe := q.client.TxPipeline()
+	pipe.ZRem(ctx, q.key("dead"), id)
+	pipe.HDel(ctx, q.key("jobs"), id)
+	pipe.HDel(ctx, q.key("attempts"), id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (q *Queue) key(name string) string {
+	return q.prefix + name
+}
+
+func (q *Queue) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	for i := 0; i < q.conf.Concurrency; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.loop(ctx)
+		}()
+	}
+}
+
+// stop stops fetching the jobs and waits for the running jobs. The jobs that do
+// not finish before ctx are delivered again after the visibility timeout.
+func (q *Queue) stop(ctx context.Context) error {
+	if q.cancel == nil {
+		return nil
+	}
+	q.cancel()
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the queue jobs did not finish: %w", ctx.Err())
+	}
+}
+
+func (q *Queue) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.fetch(ctx)
+		if err != nil && ctx.Err() == nil {
+			freedom.Logger().Errorf("[Freedom] Failed to fetch the queue job, queue:%s, error:%v", q.conf.Name, err)
+		}
+		if job == nil {
+			sleepContext(ctx, q.conf.PollInterval)
+			continue
+		}
+		q.process(job)
+	}
+}
+
+func (q *Queue) fetch(ctx context.Context) (*Job, error) {
+	now := time.Now()
+	keys := []string{q.key("ready"), q.key("delayed"), q.key("inflight"), q.key("jobs"), q.key("attempts")}
+	values, err := fetchScript.Run(ctx, q.client, keys, now.UnixMilli(), now.Add(q.conf.VisibilityTimeout).UnixMilli()).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("unexpected reply %v", values)
+	}
+	data, _ := values[1].(string)
+	attempt, _ := values[2].(int64)
+	job := new(Job)
+	if err := json.Unmarshal([]byte(data), job); err != nil {
+		return nil, fmt.Errorf("invalid job '%v': %w", values[0], err)
+	}
+	job.Attempt = int(attempt)
+	return job, nil
+}
+
+// process runs the handler, then acknowledges, retries or buries the job.
+func (q *Queue) process(job *Job) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), q.conf.VisibilityTimeout)
+	defer cancel()
+
+	err := q.call(ctx, job)
+	//The job is finished even if the visibility timeout has expired
+	ctx = context.WithoutCancel(ctx)
+	result := resultOK
+	switch {
+	case err == nil:
+		err = q.ack(ctx, job)
+	case job.Attempt > q.conf.MaxRetries:
+		result = resultDead
+		freedom.Logger().Errorf("[Freedom] The queue job is dead, queue:%s, type:%s, id:%s, attempt:%d, error:%v", q.conf.Name, job.Type, job.ID, job.Attempt, err)
+		err = q.move(ctx, job, err, "dead", time.Now())
+	default:
+		result = resultRetry
+		freedom.Logger().Infof("[Freedom] The queue job will be retried, queue:%s, type:%s, id:%s, attempt:%d, error:%v", q.conf.Name, job.Type, job.ID, job.Attempt, err)
+		err = q.move(ctx, job, err, "delayed", time.Now().Add(q.backoff(job.Attempt)))
+	}
+	if err != nil {
+		freedom.Logger().Errorf("[Freedom] Failed to finish the queue job, queue:%s, id:%s, error:%v", q.conf.Name, job.ID, err)
+	}
+	freedom.Prometheus().QueueWithLabelValues(q.conf.Name, job.Type, result, start)
+}
+
+// ack deletes a finished inflight job.
+func (q *Queue) ack(ctx context.Context, job *Job) error {
+	return ackScript.Run(ctx, q.client, []string{q.key("inflight"), q.key("jobs"), q.key("attempts")}, job.ID).Err()
+}
+
+func (q *Queue) move(ctx context.Context, job *Job, cause error, to string, at time.Time) error {
+	job.LastError = cause.Error()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	keys := []string{q.key("inflight"), q.key("jobs"), q.key(to)}
+	return moveScript.Run(ctx, q.client, keys, job.ID, data, at.UnixMilli()).Err()
+}
+
+// call calls the handler with a Worker, a panic is returned as an error.
+func (q *Queue) call(ctx context.Context, job *Job) (e error) {
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		return fmt.Errorf("the job type '%s' has no handler", job.Type)
+	}
+	defer func() {
+		if perr := recover(); perr != nil {
+			e = fmt.Errorf("panic: %v", perr)
+		}
+	}()
+
+	ftype := reflect.FuncOf([]reflect.Type{handler.Type().In(0)}, []reflect.Type{errorType}, false)
+	fun := reflect.MakeFunc(ftype, func(args []reflect.Value) []reflect.Value {
+		return handler.Call([]reflect.Value{args[0], reflect.ValueOf(job)})
+	})
+	return freedom.ServiceLocator().CallContext(ctx, fun.Interface())
+}
+
+// backoff returns the delay of the retry after the attempt, with a jitter in [d/2, d].
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.conf.MaxRetryBackoff
+	if attempt < 32 {
+		if shifted := q.conf.RetryBackoff << (attempt - 1); shifted > 0 && shifted < d {
+			d = shifted
+		}
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleepContext waits for d and returns false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
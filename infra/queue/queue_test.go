@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type testService struct{}
+
+func TestQueueHandle(t *testing.T) {
+	q := &Queue{handlers: make(map[string]reflect.Value)}
+	q.Handle("ok", func(*testService, *Job) error { return nil })
+
+	for _, handler := range []interface{}{
+		nil,
+		func(*testService) error { return nil },
+		func(testService, *Job) error { return nil },
+		func(*testService, Job) error { return nil },
+		func(*testService, *Job) {},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("the handler %T is accepted", handler)
+				}
+			}()
+			q.Handle("bad", handler)
+		}()
+	}
+	if _, err := q.Enqueue(context.Background(), "ok", nil); err == nil {
+		t.Error("the queue is not installed")
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q := &Queue{conf: Config{RetryBackoff: time.Second, MaxRetryBackoff: time.Minute}}
+	for _, tc := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, time.Second}, {2, 2 * time.Second}, {3, 4 * time.Second}, {7, time.Minute}, {100, time.Minute},
+	} {
+		d := q.backoff(tc.attempt)
+		if d < tc.max/2 || d > tc.max {
+			t.Errorf("backoff(%d) = %v, want [%v, %v]", tc.attempt, d, tc.max/2, tc.max)
+		}
+	}
+}
+
+// testRedis returns the local redis, or an in-process miniredis without it.
+// The clock of miniredis follows the wall clock so that the keys expire.
+func testRedis(t *testing.T) redis.Cmdable {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", MaxRetries: -1, DialerRetries: 1})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		server := miniredis.RunT(t)
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					server.FastForward(10 * time.Millisecond)
+				}
+			}
+		}()
+		t.Cleanup(func() {
+			close(done)
+		})
+		client = redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	}
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return client
+}
+
+func newTestQueue(t *testing.T) *Queue {
+	client := testRedis(t)
+	q := &Queue{
+		conf:      Config{Name: fmt.Sprintf("test%d", time.Now().UnixNano()), VisibilityTimeout: 200 * time.Millisecond},
+		handlers:  make(map[string]reflect.Value),
+		client:    client,
+		installed: true,
+	}
+	q.prefix = "queue:" + q.conf.Name + ":"
+	t.Cleanup(func() {
+		client.Del(context.Background(), q.key("ready"), q.key("delayed"), q.key("inflight"), q.key("dead"), q.key("jobs"), q.key("attempts"))
+	})
+	return q
+}
+
+func mustFetch(t *testing.T, q *Queue, id string, attempt int) *Job {
+	t.Helper()
+	job, err := q.fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != id || job.Attempt != attempt {
+		t.Fatalf("fetch() = %+v, want the job %s of the attempt %d", job, id, attempt)
+	}
+	return job
+}
+
+func mustEmpty(t *testing.T, q *Queue) {
+	t.Helper()
+	job, err := q.fetch(context.Background())
+	if err != nil || job != nil {
+		t.Fatalf("fetch() = %+v, %v, want no job", job, err)
+	}
+}
+
+func TestQueueAck(t *testing.T) {
+	q := newTestQueue(t)
+	ctx := context.Background()
+	id, err := q.Enqueue(ctx, "ok", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := mustFetch(t, q, id, 1)
+	var payload map[string]int
+	if err := job.Unmarshal(&payload); err != nil || payload["n"] != 1 {
+		t.Fatal("the payload is not kept", payload, err)
+	}
+	mustEmpty(t, q)
+
+	if err := q.ack(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if n := q.client.HLen(ctx, q.key("jobs")).Val() + q.client.ZCard(ctx, q.key("inflight")).Val(); n != 0 {
+		t.Fatal("the acknowledged job is kept", n)
+	}
+	//The job is not delivered again after the visibility timeout
+	time.Sleep(300 * time.Millisecond)
+	mustEmpty(t, q)
+}
+
+func TestQueueVisibilityTimeout(t *testing.T) {
+	q := newTestQueue(t)
+	ctx := context.Background()
+	id, _ := q.Enqueue(ctx, "ok", nil)
+	mustFetch(t, q, id, 1)
+	time.Sleep(300 * time.Millisecond)
+	mustFetch(t, q, id, 2)
+
+	delayed, _ := q.Enqueue(ctx, "ok", nil, time.Hour)
+	mustEmpty(t, q)
+	if score := q.client.ZScore(ctx, q.key("delayed"), delayed).Val(); score <= float64(time.Now().UnixMilli()) {
+		t.Fatal("the delayed job must wait", score)
+	}
+}
+
+func TestQueueRetryDead(t *testing.T) {
+	q := newTestQueue(t)
+	ctx := context.Background()
+	id, _ := q.Enqueue(ctx, "ok", nil)
+
+	job := mustFetch(t, q, id, 1)
+	if err := q.move(ctx, job, errors.New("retry"), "delayed", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	job = mustFetch(t, q, id, 2)
+	if job.LastError != "retry" {
+		t.Fatal("the error of the attempt is not kept", job.LastError)
+	}
+
+	if err := q.move(ctx, job, errors.New("dead"), "dead", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	mustEmpty(t, q)
+	dead, err := q.DeadJobs(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != id || dead[0].LastError != "dead" {
+		t.Fatal("the dead job is not found", dead, err)
+	}
+
+	if err := q.RetryDead(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.RetryDead(ctx, id); err == nil {
+		t.Fatal("the job is no longer dead")
+	}
+	mustFetch(t, q, id, 1)
+}
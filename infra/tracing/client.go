@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/8treenet/freedom/infra/requests"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewClient HTTP Client middleware that creates the client span of the request.
+// The parent is the span in the context of the request, Repository.NewHTTPRequest
+// and Infra.NewHTTPRequest use Worker.Context(). The traceparent of the span is sent.
+func NewClient() requests.Handler {
+	return func(middle requests.Middleware) {
+		request := middle.GetRequest()
+		ctx, span := tracer().Start(middle.Context(), request.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("http.request.method", request.Method),
+				attribute.String("url.full", request.URL.String()),
+				attribute.String("server.address", request.URL.Host),
+			))
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+		middle.WithContextFromMiddleware(ctx)
+
+		middle.Next()
+
+		response := middle.GetRespone()
+		if response.Error != nil {
+			endSpan(span, response.Error)
+			return
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+		if response.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, fmt.Sprint(response.StatusCode))
+		}
+		span.End()
+	}
+}
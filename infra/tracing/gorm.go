@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "freedom:tracing:span"
+
+// NewGormPlugin Returns the GORM plugin that creates a span for every statement.
+// The parent is the span in the context of the statement, the handles returned by
+// Repository.FetchDB carry Worker.Context() once the plugin is used.
+//
+//	db.Use(tracing.NewGormPlugin())
+func NewGormPlugin() gorm.Plugin {
+	return new(gormPlugin)
+}
+
+type gormPlugin struct{}
+
+// Name .
+func (plugin *gormPlugin) Name() string {
+	return "freedom:tracing"
+}
+
+// Initialize Registers the callbacks around the statements.
+func (plugin *gormPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	registers := []struct {
+		operation string
+		before    func(string, func(*gorm.DB)) error
+		after     func(string, func(*gorm.DB)) error
+	}{
+		{"create", callback.Create().Before("gorm:create").Register, callback.Create().After("gorm:create").Register},
+		{"query", callback.Query().Before("gorm:query").Register, callback.Query().After("gorm:query").Register},
+		{"update", callback.Update().Before("gorm:update").Register, callback.Update().After("gorm:update").Register},
+		{"delete", callback.Delete().Before("gorm:delete").Register, callback.Delete().After("gorm:delete").Register},
+		{"row", callback.Row().Before("gorm:row").Register, callback.Row().After("gorm:row").Register},
+		{"raw", callback.Raw().Before("gorm:raw").Register, callback.Raw().After("gorm:raw").Register},
+	}
+	for _, register := range registers {
+		if err := register.before("freedom:tracing:before_"+register.operation, plugin.before(register.operation)); err != nil {
+			return err
+		}
+		if err := register.after("freedom:tracing:after_"+register.operation, plugin.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (plugin *gormPlugin) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		name := operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		_, span := tracer().Start(db.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system.name", db.Dialector.Name()),
+				attribute.String("db.operation.name", operation),
+				attribute.String("db.collection.name", db.Statement.Table),
+			))
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func (plugin *gormPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.query.text", db.Statement.SQL.String()),
+		attribute.Int64("db.response.rows_affected", db.RowsAffected),
+	)
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	endSpan(span, err)
+}
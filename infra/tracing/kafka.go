@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"github.com/8treenet/freedom/infra/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewProducer Kafka Producer middleware that creates the producer span of the message.
+// The parent is the span in Msg.Context(), which is set by Msg.SetWorker.
+// The traceparent of the span is sent in the headers of the message.
+func NewProducer() kafka.ProducerHandler {
+	return func(msg *kafka.Msg) {
+		ctx, span := tracer().Start(msg.Context(), "publish "+msg.Topic,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.operation.type", "send"),
+				attribute.String("messaging.destination.name", msg.Topic),
+			))
+
+		carrier := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+		header := make(map[string]interface{}, len(carrier))
+		for key, value := range carrier {
+			header[key] = value
+		}
+		msg.SetHeader(header).WithContext(ctx)
+
+		msg.Next()
+		span.SetAttributes(attribute.String("messaging.kafka.message.key", msg.GetMessageKey()))
+		endSpan(span, msg.GetExecution())
+	}
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/8treenet/freedom"
+	"github.com/8treenet/iris/v12/context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewServer The HTTP middleware that creates the server span of the request.
+// The parent is the traceparent of the caller. Worker.Context() and the request
+// context carry the span, so the spans of the request are its children.
+func NewServer() func(context.Context) {
+	return func(ctx context.Context) {
+		request := ctx.Request()
+		parent := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		route := request.URL.Path
+		if current := ctx.GetCurrentRoute(); current != nil {
+			route = current.Path()
+		}
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", request.Method),
+			attribute.String("url.path", request.URL.Path),
+			attribute.String("http.route", route),
+		}
+		spanCtx, span := tracer().Start(parent, request.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		ctx.ResetRequest(request.WithContext(spanCtx))
+		if worker := freedom.ToWorker(ctx); worker != nil {
+			worker.WithContext(trace.ContextWithSpan(worker.Context(), span))
+			//The services without the tracing continue the trace of the span
+			if sc := span.SpanContext(); sc.IsValid() {
+				worker.Bus().SetTraceContext(freedom.TraceContext{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String(), Flags: byte(sc.TraceFlags())})
+			}
+		}
+
+		ctx.Next()
+
+		status := ctx.GetStatusCode()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprint(status))
+		}
+	}
+}
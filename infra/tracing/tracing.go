@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/8treenet/freedom"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	freedom.Prepare(func(initiator freedom.Initiator) {
+		initiator.BindInfra(true, provider)
+	})
+}
+
+// tracerName is the instrumentation name of the spans.
+const tracerName = "github.com/8treenet/freedom/infra/tracing"
+
+var provider = new(Provider)
+
+// Config The configuration of the tracing.
+type Config struct {
+	// ServiceName is the service.name of the spans.
+	ServiceName string
+	// Exporter receives the finished spans, for example an OTLP exporter or
+	// tracetest.NewInMemoryExporter in the unit tests.
+	Exporter sdktrace.SpanExporter
+	// Sampler of the root spans, the spans follow the decision of the parent.
+	// sdktrace.AlwaysSample() by default.
+	Sampler sdktrace.Sampler
+	// Batch exports the spans in the background, otherwise they are exported
+	// synchronously when they end.
+	Batch bool
+}
+
+// Provider The tracing component, the spans are flushed when the application stops.
+type Provider struct {
+	freedom.Infra
+	tracerProvider *sdktrace.TracerProvider
+}
+
+// Install Installs the TracerProvider and the W3C propagators globally.
+// Install the middlewares to create the spans:
+//
+//	app.InstallMiddleware(tracing.NewServer())
+//	requests.InstallMiddleware(tracing.NewClient())
+//	kafka.InstallMiddleware(tracing.NewProducer())
+//	db.Use(tracing.NewGormPlugin())
+//
+// The kafka consumer creates its spans once the provider is installed.
+func Install(conf Config) *sdktrace.TracerProvider {
+	sampler := conf.Sampler
+	if sampler == nil {
+		sampler = sdktrace.AlwaysSample()
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", conf.ServiceName))),
+	}
+	if conf.Exporter != nil {
+		if conf.Batch {
+			opts = append(opts, sdktrace.WithBatcher(conf.Exporter))
+		} else {
+			opts = append(opts, sdktrace.WithSyncer(conf.Exporter))
+		}
+	}
+
+	provider.tracerProvider = sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider.tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.tracerProvider
+}
+
+// Booting The method of overriding the component .
+// The single-case component initiates a callback.
+func (p *Provider) Booting(bootManager freedom.BootManager) {
+	bootManager.RegisterHook(freedom.LifecycleHook{
+		Name:  "tracing",
+		Phase: freedom.OnStop,
+		Func: func(ctx context.Context) error {
+			if p.tracerProvider == nil {
+				return nil
+			}
+			return p.tracerProvider.Shutdown(ctx)
+		},
+	})
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
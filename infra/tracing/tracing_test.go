@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/8treenet/freedom/infra/kafka"
+	"github.com/8treenet/freedom/infra/requests"
+	iris "github.com/8treenet/iris/v12"
+	irisContext "github.com/8treenet/iris/v12/context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+var exporter = tracetest.NewInMemoryExporter()
+
+func init() {
+	Install(Config{ServiceName: "test", Exporter: exporter})
+	requests.InstallMiddleware(NewClient())
+	kafka.InstallMiddleware(NewProducer())
+}
+
+// span returns the exported span of the name.
+func span(t *testing.T, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, stub := range exporter.GetSpans() {
+		if stub.Name == name {
+			return stub
+		}
+	}
+	t.Fatal("the span is not exported", name, exporter.GetSpans())
+	return tracetest.SpanStub{}
+}
+
+func attr(stub tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range stub.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestServer(t *testing.T) {
+	exporter.Reset()
+	app := iris.New()
+	app.Use(NewServer())
+	var handled trace.SpanContext
+	app.Get("/goods/{id}", func(ctx irisContext.Context) {
+		handled = trace.SpanContextFromContext(ctx.Request().Context())
+		ctx.StatusCode(http.StatusInternalServerError)
+	})
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/goods/1", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	app.ServeHTTP(httptest.NewRecorder(), request)
+
+	stub := span(t, "GET /goods/{id}")
+	if stub.SpanKind != trace.SpanKindServer || stub.Parent.SpanID().String() != "00f067aa0ba902b7" || stub.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatal("the server span must continue the trace of the caller", stub.Parent, stub.SpanContext)
+	}
+	if handled.SpanID() != stub.SpanContext.SpanID() {
+		t.Fatal("the request context must carry the server span")
+	}
+	if stub.Status.Code != codes.Error || attr(stub, "http.response.status_code").AsInt64() != 500 {
+		t.Fatal("the status of the response must be recorded", stub.Status, stub.Attributes)
+	}
+}
+
+func TestClientAndProducer(t *testing.T) {
+	exporter.Reset()
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, root := tracer().Start(context.Background(), "root")
+	requests.NewHTTPRequest(server.URL).WithContext(ctx).Get().ToString()
+	err := kafka.GetProducer().NewMsg("goods", []byte("{}")).WithContext(ctx).Publish()
+	root.End()
+
+	client := span(t, "GET")
+	if client.SpanKind != trace.SpanKindClient || client.Parent.SpanID() != root.SpanContext().SpanID() {
+		t.Fatal("the client span must be a child of the context", client.Parent)
+	}
+	if !strings.Contains(traceparent, client.SpanContext.SpanID().String()) {
+		t.Fatal("the traceparent of the client span must be sent", traceparent)
+	}
+
+	producer := span(t, "publish goods")
+	if producer.SpanKind != trace.SpanKindProducer || producer.Parent.SpanID() != root.SpanContext().SpanID() {
+		t.Fatal("the producer span must be a child of the context", producer.Parent)
+	}
+	if err == nil || producer.Status.Code != codes.Error {
+		t.Fatal("the error of the producer must be recorded", err, producer.Status)
+	}
+}
+
+type testUser struct {
+	ID   int
+	Name string
+}
+
+func TestGormPlugin(t *testing.T) {
+	exporter.Reset()
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewGormPlugin()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, root := tracer().Start(context.Background(), "root")
+	var users []testUser
+	db.WithContext(ctx).Where("id = ?", 1).Find(&users)
+	root.End()
+
+	stub := span(t, "query test_users")
+	if stub.Parent.SpanID() != root.SpanContext().SpanID() || !strings.Contains(attr(stub, "db.query.text").AsString(), "SELECT") {
+		t.Fatal("the statement must be traced as a child of the context", stub.Parent, stub.Attributes)
+	}
+}
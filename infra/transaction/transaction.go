@@ -22,6 +22,8 @@ func init() {
 type Transaction interface {
 	// Incoming functions to be executed, using the same handle within the function.
 	Execute(fun func() error, opts ...*sql.TxOptions) (e error)
+	// Incoming functions to be executed on the named data source.
+	ExecuteNamed(name string, fun func() error, opts ...*sql.TxOptions) (e error)
 }
 
 var _ Transaction = (*GormImpl)(nil)
@@ -39,26 +41,66 @@ func (t *GormImpl) BeginRequest(worker freedom.Worker) {
 
 // Execute An execution function is passed in, and transactions are executed within the function.
 func (t *GormImpl) Execute(fun func() error, opts ...*sql.TxOptions) (e error) {
-	return t.execute(t.Worker().Context(), fun, opts...)
+	return t.execute(t.Worker().Context(), "", fun, opts...)
+}
+
+// ExecuteNamed An execution function is passed in, and transactions are executed within the function.
+// The transaction is opened on the data source installed under name,
+// repositories only see it through FetchNamedDB with the same name.
+func (t *GormImpl) ExecuteNamed(name string, fun func() error, opts ...*sql.TxOptions) (e error) {
+	return t.execute(t.Worker().Context(), name, fun, opts...)
 }
 
 // execute .
-func (t *GormImpl) execute(ctx context.Context, fun func() error, opts ...*sql.TxOptions) (e error) {
+func (t *GormImpl) execute(ctx context.Context, name string, fun func() error, opts ...*sql.TxOptions) (e error) {
 	var db *gorm.DB
-	if err := t.FetchOnlyDB(&db); err != nil {
+	if err := t.FetchOnlyNamedDB(name, &db); err != nil {
 		return err
 	}
 
-	return db.Transaction(func(tx *gorm.DB) (e error) {
-		t.Worker().Store().Set(freedom.TransactionKey, tx)
+	key := freedom.NamedTransactionKey(name)
+	e = db.Transaction(func(tx *gorm.DB) (e error) {
+		t.Worker().Store().Set(key, tx)
 		defer func() {
 			if perr := recover(); perr != nil {
 				e = errors.New(fmt.Sprint(perr))
 			}
-			t.Worker().Store().Remove(freedom.TransactionKey)
+			t.Worker().Store().Remove(key)
 		}()
 
 		e = fun()
 		return
 	}, opts...)
+
+	callbacks, _ := t.Worker().Store().Get(afterCommitKey(name)).([]func())
+	t.Worker().Store().Remove(afterCommitKey(name))
+	if e != nil {
+		return
+	}
+	for _, callback := range callbacks {
+		callback()
+	}
+	return
+}
+
+// AfterCommit Calls fun after the transaction of the worker commits, fun is
+// discarded if the transaction rolls back. Without a transaction fun is called now.
+// The optional name is the data source of the transaction, see ExecuteNamed.
+func AfterCommit(worker freedom.Worker, fun func(), name ...string) {
+	dsName := ""
+	if len(name) > 0 {
+		dsName = name[0]
+	}
+	if worker.Store().Get(freedom.NamedTransactionKey(dsName)) == nil {
+		fun()
+		return
+	}
+	callbacks, _ := worker.Store().Get(afterCommitKey(dsName)).([]func())
+	worker.Store().Set(afterCommitKey(dsName), append(callbacks, fun))
+}
+
+// afterCommitKey is prefixed with the transaction key, the callbacks are not
+// copied to a detached Worker.
+func afterCommitKey(name string) string {
+	return freedom.NamedTransactionKey(name) + "#after_commit"
 }
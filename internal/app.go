@@ -5,14 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"reflect"
 	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 
 	"github.com/8treenet/iris/v12"
+	"github.com/8treenet/iris/v12/core/host"
 	"github.com/8treenet/iris/v12/mvc"
 	"github.com/kataras/golog"
 	"github.com/redis/go-redis/v9"
@@ -43,6 +46,8 @@ type Application struct {
 
 	// Service locator .
 	serviceLocator *ServiceLocatorImpl
+	scheduler      *scheduler
+	leaderElector  LeaderElector
 
 	// A pool of reusable services .
 	pool *servicePool
@@ -62,6 +67,22 @@ type Application struct {
 	// Custom data sources .
 	other *custom
 
+	// Hooks of the application phases .
+	lifecycle *lifecycle
+
+	// Callbacks of RegisterShutdown .
+	shutdownList []func()
+
+	// The workers that have not finished .
+	inflight inflight
+
+	// Set to 1 when the shutdown begins .
+	draining int32
+
+	// The context of the detached workers, canceled when the application has shut down .
+	background       stdcontext.Context
+	backgroundCancel stdcontext.CancelFunc
+
 	// unmarshal is a global deserializer for deserialize every []byte into object.
 	unmarshal func(data []byte, v interface{}) error
 
@@ -72,6 +93,9 @@ type Application struct {
 	// iris controller.
 	controllerDependencies []interface{}
 
+	// controllers are the bound controllers, used by the dependency graph.
+	controllers []controllerBinding
+
 	// TODO(coco):
 	//  Here is bad smell I felt, so we shouldn't export this member. Considering
 	//  sets this member unexported in the future.
@@ -81,7 +105,8 @@ type Application struct {
 
 	// Database represents a database connection
 	Database struct {
-		db      interface{}
+		primary dataSource
+		sources []*dataSource
 		Install func() (db interface{})
 	}
 
@@ -110,11 +135,17 @@ func NewApplication() *Application {
 		globalApp.comPool = newInfraPool()
 		globalApp.subEventManager = newEventPathManager()
 		globalApp.other = newCustom()
+		globalApp.lifecycle = newLifecycle()
+		globalApp.background, globalApp.backgroundCancel = stdcontext.WithCancel(stdcontext.Background())
 		globalApp.marshal = json.Marshal
 		globalApp.unmarshal = json.Unmarshal
 		globalApp.Prometheus = newPrometheus()
 		globalApp.serviceLocator = newServiceLocator()
+		globalApp.scheduler = newScheduler()
 		globalApp.IrisApp.Logger().SetTimeFormat("2006-01-02 15:04:05.000")
+		if os.Getenv(GraphEnv) != "" {
+			globalApp.IrisApp.Logger().SetLevel("disable")
+		}
 	})
 	return globalApp
 }
@@ -209,6 +240,7 @@ func (app *Application) BindController(relativePath string, controller IrisContr
 	mvcApp.Handle(controller)
 
 	app.subEventManager.addController(controller)
+	app.controllers = append(app.controllers, controllerBinding{path: app.withPrefix(relativePath), controller: controller})
 }
 
 // BindControllerWithParty accepts an IrisRouter and an IrisController.
@@ -219,6 +251,8 @@ func (app *Application) BindControllerWithParty(router IrisParty, controller Iri
 	mvcApp := mvc.New(router)
 	mvcApp.Register(app.resolveDependencies()...)
 	mvcApp.Handle(controller)
+
+	app.controllers = append(app.controllers, controllerBinding{path: router.GetRelPath(), controller: controller})
 }
 
 // BindControllerByParty accepts an IrisRouter and an IrisController.
@@ -230,30 +264,33 @@ func (app *Application) BindControllerByParty(router IrisParty, controller inter
 }
 
 // BindService Bind a function that creates the service.
-func (app *Application) BindService(f interface{}) {
+// The optional lifetime is PerRequest by default.
+func (app *Application) BindService(f interface{}, lifetime ...Lifetime) {
 	outType, err := parsePoolFunc(f)
 	if err != nil {
 		globalApp.Logger().Fatalf("[Freedom] BindService: The binding function is incorrect, %v : %s", f, err.Error())
 	}
-	app.pool.bind(outType, f)
+	app.pool.bind(outType, f, parseLifetime(lifetime))
 }
 
 // BindRepository Bind a function that creates the repository.
-func (app *Application) BindRepository(f interface{}) {
+// The optional lifetime is PerRequest by default.
+func (app *Application) BindRepository(f interface{}, lifetime ...Lifetime) {
 	outType, err := parsePoolFunc(f)
 	if err != nil {
 		globalApp.Logger().Fatalf("[Freedom] BindRepository: The binding function is incorrect, %v : %s", f, err.Error())
 	}
-	app.rpool.bind(outType, f)
+	app.rpool.bind(outType, f, parseLifetime(lifetime))
 }
 
 // BindFactory Bind a function that creates the repository.
-func (app *Application) BindFactory(f interface{}) {
+// The optional lifetime is PerRequest by default.
+func (app *Application) BindFactory(f interface{}, lifetime ...Lifetime) {
 	outType, err := parsePoolFunc(f)
 	if err != nil {
 		globalApp.Logger().Fatalf("[Freedom] BindFactory: The binding function is incorrect, %v : %s", f, err.Error())
 	}
-	app.factoryPool.bind(outType, f)
+	app.factoryPool.bind(outType, f, parseLifetime(lifetime))
 }
 
 // BindInfra Bind a function that creates the repository infrastructure.
@@ -277,7 +314,17 @@ func (app *Application) BindInfra(single bool, com interface{}) {
 // objectMethod is the controller that needs to be received.
 // sequential specifies whether to process messages sequentially (true) or concurrently (false).
 func (app *Application) ListenEvent(eventName string, objectMethod string, sequential bool) {
-	app.subEventManager.addEvent(objectMethod, eventName, sequential)
+	mode := EventConcurrent
+	if sequential {
+		mode = EventSequential
+	}
+	app.subEventManager.addEvent(objectMethod, eventName, mode)
+}
+
+// ListenEventWithMode You need to listen for message events using http agents.
+// mode specifies how the messages are processed, see EventKeyOrdered.
+func (app *Application) ListenEventWithMode(eventName string, objectMethod string, mode EventMode) {
+	app.subEventManager.addEvent(objectMethod, eventName, mode)
 }
 
 // EventsPath Gets the event name and HTTP routing address for Listen.
@@ -290,6 +337,11 @@ func (app *Application) EventsSequential(infra interface{}) map[string]bool {
 	return app.subEventManager.EventsSequential(infra)
 }
 
+// EventsMode Gets the processing mode for each topic.
+func (app *Application) EventsMode(infra interface{}) map[string]EventMode {
+	return app.subEventManager.EventsMode(infra)
+}
+
 // InjectIntoController Adds a Dependency for iris controller.
 func (app *Application) InjectIntoController(f Dependency) {
 	app.controllerDependencies = append(app.controllerDependencies, f)
@@ -303,8 +355,15 @@ func (app *Application) InjectController(f Dependency) {
 }
 
 // RegisterShutdown Register an inflatable callback function.
+// The callbacks run in the order of registration before the server stops,
+// after the OnDrain hooks. Use RegisterHook to order them with the hooks.
 func (app *Application) RegisterShutdown(f func()) {
-	app.comPool.registerShutdown(f)
+	app.shutdownList = append(app.shutdownList, f)
+}
+
+// RegisterHook Register a hook that runs in a phase of the application.
+func (app *Application) RegisterHook(hook LifecycleHook) {
+	app.lifecycle.register(hook)
 }
 
 // InstallDB Install the database.
@@ -346,6 +405,22 @@ func (app *Application) BindBooting(f func(bootManager BootManager)) {
 	bootManagers = append(bootManagers, f)
 }
 
+// BindJob Binds a function that runs the service on the schedule of spec.
+// The function is called like ServiceLocator().Call and returns an error.
+//
+//	initiator.BindJob("*/5 * * * *", func(service *OrderService) error {
+//		return service.CloseExpired()
+//	}, &freedom.JobConfig{Timeout: time.Minute})
+//
+// The spec is a cron expression of 5 fields, 6 fields with the seconds first,
+// a descriptor like "@daily" or a fixed interval like "@every 30s". The jobs run
+// from OnReady to OnDrain.
+func (app *Application) BindJob(spec string, f interface{}, conf ...*JobConfig) {
+	if err := app.scheduler.bind(spec, f, conf...); err != nil {
+		globalApp.Logger().Fatalf("[Freedom] BindJob: The job is incorrect, %v : %s", f, err.Error())
+	}
+}
+
 // NewRunner can be used as an argument for the `Run` method.
 // It accepts a host address which is used to build a server
 // and a listener which listens on that host and port.
@@ -450,6 +525,13 @@ func (app *Application) Run(runner IrisRunner, conf IrisConfiguration) {
 	}
 	globalApp.IrisApp.Logger().SetLevel(logLevel)
 
+	if format := os.Getenv(GraphEnv); format != "" {
+		app.printGraph(format)
+		return
+	}
+
+	app.registerHealth(conf)
+	app.registerGraph(conf)
 	app.addMiddlewares(conf)
 	app.installDB()
 	app.other.booting()
@@ -459,22 +541,39 @@ func (app *Application) Run(runner IrisRunner, conf IrisConfiguration) {
 
 	repositoryAPIRun(conf)
 	app.subEventManager.building()
+	app.checkDependencies(conf)
 
 	app.comPool.singleBooting(app)
 	for i := 0; i < len(bootManagers); i++ {
 		bootManagers[i](app)
 	}
+	app.scheduler.registerHooks(app.lifecycle)
 
-	shutdownSecond := 2
-	if level, ok := conf.Other["shutdown_second"]; ok {
-		i, err := strconv.Atoi(fmt.Sprint(level))
-		if err != nil {
-			panic(err)
-		}
-		shutdownSecond = i
+	if err := app.lifecycle.run(stdcontext.Background(), OnStart); err != nil {
+		app.Logger().Fatalf("[Freedom] Failed to start the application, %v", err)
 	}
-	app.shutdown(shutdownSecond)
+	app.ready()
+	interrupted, done := app.shutdown(configInt(conf, "shutdown_second", 2), configInt(conf, "drain_second", 0), configInt(conf, "stop_second", 5), configInt(conf, "recycle_second", 3))
 	app.Iris().Run(runner, iris.WithConfiguration(conf))
+	select {
+	case <-interrupted:
+		// The server is stopped by the shutdown, wait for the OnStop hooks.
+		<-done
+	default:
+	}
+}
+
+// configInt returns the integer value of conf.Other[key], def if it is not configured.
+func configInt(conf IrisConfiguration, key string, def int) int {
+	value, ok := conf.Other[key]
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(fmt.Sprint(value))
+	if err != nil {
+		panic(err)
+	}
+	return i
 }
 
 // withPrefix returns a string with a path prefixed by prefixPath.
@@ -482,21 +581,70 @@ func (app *Application) withPrefix(path string) string {
 	return app.prefixPath + path
 }
 
-func (app *Application) shutdown(timeout int) {
+// ready runs the OnReady hooks once the server is listening.
+func (app *Application) ready() {
+	var once sync.Once
+	app.Iris().ConfigureHost(func(su *host.Supervisor) {
+		su.RegisterOnServe(func(host.TaskHost) {
+			once.Do(func() {
+				if err := app.lifecycle.run(stdcontext.Background(), OnReady); err != nil {
+					app.Logger().Errorf("[Freedom] An error was encountered while the application is ready, %v", err)
+				}
+			})
+		})
+	})
+}
+
+// shutdown registers the shutdown of the application on interrupt, the returned
+// channels are closed when the shutdown begins and when it is finished.
+// The application is drained first, then the callbacks of RegisterShutdown run,
+// the server stops, the DeferRecycle workers are waited and the OnStop hooks run.
+// The drain and the server are bounded by timeout, the DeferRecycle workers by
+// recycleTimeout and the OnStop hooks by stopTimeout.
+func (app *Application) shutdown(timeout, drainPeriod, stopTimeout, recycleTimeout int) (interrupted, done <-chan struct{}) {
+	interruptedCh := make(chan struct{})
+	doneCh := make(chan struct{})
 	iris.RegisterOnInterrupt(func() {
-		//读取配置的关闭最长时间
-		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), time.Duration(timeout)*time.Second)
-		defer cancel()
-		close := func() {
-			if err := recover(); err != nil {
-				app.Logger().Errorf("[Freedom] An error was encountered during the program shutdown, %v", err)
-			}
-			app.comPool.shutdown()
-		}
-		close()
-		//通知组件服务即将关闭
-		app.Iris().Shutdown(ctx)
+		close(interruptedCh)
+		defer close(doneCh)
+		app.stop(time.Duration(timeout)*time.Second, time.Duration(drainPeriod)*time.Second, time.Duration(stopTimeout)*time.Second, time.Duration(recycleTimeout)*time.Second)
 	})
+	return interruptedCh, doneCh
+}
+
+// stop runs the shutdown. The DeferRecycle workers and the OnStop hooks have
+// their own budgets, the OnStop hooks run even if the drain has used all of timeout.
+func (app *Application) stop(timeout, drainPeriod, stopTimeout, recycleTimeout time.Duration) {
+	//读取配置的关闭最长时间
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), timeout)
+	defer cancel()
+
+	app.drain(ctx, drainPeriod)
+	app.runShutdownList()
+	//通知组件服务即将关闭
+	app.Iris().Shutdown(ctx)
+	app.backgroundCancel()
+	app.waitDeferred(recycleTimeout)
+
+	stopCtx, stopCancel := stdcontext.WithTimeout(stdcontext.Background(), stopTimeout)
+	defer stopCancel()
+	if err := app.lifecycle.run(stopCtx, OnStop); err != nil {
+		app.Logger().Errorf("[Freedom] An error was encountered during the program shutdown, %v", err)
+	}
+}
+
+// runShutdownList calls the callbacks of RegisterShutdown in the order of registration.
+func (app *Application) runShutdownList() {
+	for _, f := range app.shutdownList {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					app.Logger().Errorf("[Freedom] An error was encountered during the program shutdown, %v", err)
+				}
+			}()
+			f()
+		}()
+	}
 }
 
 func (app *Application) resolveDependencies() []Dependency {
@@ -512,8 +660,10 @@ func (app *Application) resolveDependencies() []Dependency {
 }
 
 func (app *Application) installDB() {
-	if app.Database.Install != nil {
-		app.Database.db = app.Database.Install()
+	app.Database.primary.install = app.Database.Install
+	app.Database.primary.booting()
+	for _, source := range app.Database.sources {
+		source.booting()
 	}
 
 	if app.Cache.Install != nil {
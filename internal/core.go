@@ -32,15 +32,18 @@ type Initiator interface {
 	// on IrisRouter and the EventBus after it has created.
 	BindControllerWithParty(party iris.Party, controller interface{})
 	// Bind a function that creates the service.
-	BindService(f interface{})
+	// The optional lifetime is PerRequest by default.
+	BindService(f interface{}, lifetime ...Lifetime)
 	// Adds a Dependency for iris controller.
 	// Because of ambiguous naming, I've been create InjectIntoController as an
 	// alternative. Considering remove this function in the future.
 	InjectController(f interface{})
 	// Bind a function that creates the repository.
-	BindRepository(f interface{})
+	// The optional lifetime is PerRequest by default.
+	BindRepository(f interface{}, lifetime ...Lifetime)
 	// Bind a function that creates the repository.
-	BindFactory(f interface{})
+	// The optional lifetime is PerRequest by default.
+	BindFactory(f interface{}, lifetime ...Lifetime)
 
 	// Accepts an IrisContext and a pointer to the typed service. GetService
 	// looks up a service from the ServicePool by the type of the pointer and fill
@@ -65,8 +68,14 @@ type Initiator interface {
 	// objectMethod is the controller that needs to be received.
 	// sequential specifies whether to process messages sequentially (true) or concurrently (false).
 	ListenEvent(eventName string, objectMethod string, sequential bool)
+	// You need to listen for message events using http agents.
+	// mode specifies how the messages are processed, see EventKeyOrdered.
+	ListenEventWithMode(eventName string, objectMethod string, mode EventMode)
 	// Adds a builder function which builds a BootManager.
 	BindBooting(f func(bootManager BootManager))
+	// Bind a function that runs the service on the schedule of spec,
+	// a cron expression or a fixed interval like "@every 30s".
+	BindJob(spec string, f interface{}, conf ...*JobConfig)
 	// Go back to the iris app.
 	Iris() *iris.Application
 }
@@ -81,8 +90,14 @@ type BootManager interface {
 	EventsPath(infra interface{}) map[string]string
 	// Gets the sequential/concurrent configuration for each topic.
 	EventsSequential(infra interface{}) map[string]bool
-	// Register an inflatable callback function.
+	// Gets the processing mode for each topic.
+	EventsMode(infra interface{}) map[string]EventMode
+	// Register an inflatable callback function, it runs before the server stops.
 	RegisterShutdown(func())
+	// Register a hook that runs in a phase of the application.
+	RegisterHook(hook LifecycleHook)
+	// Install the leader elector, the leader only jobs and hooks run on the leader.
+	InstallLeaderElector(elector LeaderElector)
 }
 
 // BeginRequest Requests to start the interface, and the call is triggered when the instance is implemented.
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule returns the next time of a job after t, the zero time if there is none.
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+// intervalSchedule runs every interval, "@every 10s".
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// cronSchedule is a cron expression, every field is a bit set of the allowed values.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// domStar or dowStar is set if the field is "*" or "?", a day matches both
+	// fields then. Otherwise a day matches either field like the Vixie cron.
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{min: 0, max: 59}
+	minuteField = cronField{min: 0, max: 59}
+	hourField   = cronField{min: 0, max: 23}
+	domField    = cronField{min: 1, max: 31}
+	monthField  = cronField{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule parses the spec of a job. The spec is a cron expression of 5
+// fields "minute hour day-of-month month day-of-week", 6 fields with the seconds
+// first, a descriptor like "@daily" or a fixed interval like "@every 1m30s".
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval '%s': %w", spec, err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("invalid interval '%s': it must be at least 1s", spec)
+		}
+		return intervalSchedule{interval: interval}, nil
+	}
+	if expression, ok := cronDescriptors[spec]; ok {
+		spec = expression
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression '%s': 5 or 6 fields are expected", spec)
+	}
+
+	var (
+		s   cronSchedule
+		err error
+	)
+	parsers := []struct {
+		field cronField
+		bits  *uint64
+	}{
+		{secondField, &s.second}, {minuteField, &s.minute}, {hourField, &s.hour},
+		{domField, &s.dom}, {monthField, &s.month}, {dowField, &s.dow},
+	}
+	for i, parser := range parsers {
+		if *parser.bits, err = parser.field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", spec, err)
+		}
+	}
+	//7 is Sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = fields[3] == "*" || fields[3] == "?"
+	s.dowStar = fields[5] == "*" || fields[5] == "?"
+	return s, nil
+}
+
+// parse parses a comma separated list of "*", "a", "a-b", each with an optional "/step".
+func (field cronField) parse(expression string) (bits uint64, e error) {
+	for _, item := range strings.Split(expression, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			if step, e = strconv.Atoi(stepExpr); e != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", item)
+			}
+		}
+
+		var low, high int
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			low, high = field.min, field.max
+		case strings.Contains(rangeExpr, "-"):
+			lowExpr, highExpr, _ := strings.Cut(rangeExpr, "-")
+			if low, e = field.value(lowExpr); e != nil {
+				return 0, e
+			}
+			if high, e = field.value(highExpr); e != nil {
+				return 0, e
+			}
+		default:
+			if low, e = field.value(rangeExpr); e != nil {
+				return 0, e
+			}
+			high = low
+			if hasStep {
+				high = field.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range '%s'", item)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func (field cronField) value(expression string) (int, error) {
+	if value, ok := field.names[strings.ToLower(expression)]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(expression)
+	if err != nil || value < field.min || value > field.max {
+		return 0, fmt.Errorf("'%s' is not in [%d, %d]", expression, field.min, field.max)
+	}
+	return value, nil
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next finds the next time field by field, a field that wraps around restarts
+// the search from the month. The search gives up after 5 years.
+func (s cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Second).Add(time.Second)
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc).AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc).Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+	for s.second&(1<<uint(t.Second())) == 0 {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+	return t
+}
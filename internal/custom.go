@@ -32,6 +32,24 @@ func (c *custom) booting() {
 	}
 }
 
+// fetch sets value with the custom data source of its type, false if it is not installed.
+func (c *custom) fetch(value reflect.Value) bool {
+	vtype := value.Type()
+	for vtype.Kind() != reflect.Struct {
+		if vtype.Kind() != reflect.Ptr {
+			return false
+		}
+		vtype = vtype.Elem()
+	}
+
+	poolValue, ok := c.pool[vtype]
+	if !ok || !poolValue.Type().AssignableTo(value.Type()) {
+		return false
+	}
+	value.Set(poolValue)
+	return true
+}
+
 func (c *custom) get(object interface{}) {
 	value := reflect.ValueOf(object)
 	vtype := value.Type()
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	// primaryKey marks in the first-level cache that the request has written to
+	// the primary database, the later reads of the request go to the primary too.
+	primaryKey = "freedom_local_primary_db"
+)
+
+// dataSource is a database installed under a name by InstallNamedDB.
+type dataSource struct {
+	name            string
+	install         func() interface{}
+	db              interface{}
+	replicaInstalls []func() interface{}
+	replicas        []interface{}
+	next            uint32
+	// router is the primary whose reads are routed, see routeReads.
+	router interface{}
+}
+
+// replica returns a replica in round-robin, the primary if no replica is installed.
+func (source *dataSource) replica() interface{} {
+	if len(source.replicas) == 0 {
+		return source.db
+	}
+	index := atomic.AddUint32(&source.next, 1)
+	return source.replicas[index%uint32(len(source.replicas))]
+}
+
+// booting installs the primary and the replicas.
+func (source *dataSource) booting() {
+	if source.install != nil {
+		source.db = source.install()
+	}
+	source.replicas = source.replicas[:0]
+	for _, install := range source.replicaInstalls {
+		source.replicas = append(source.replicas, install())
+	}
+	if len(source.replicas) > 0 {
+		registerReadRouter(source)
+	}
+}
+
+// NamedTransactionKey Returns the first-level cache key of the transaction
+// DB handle for the named data source.
+// The default data source uses TransactionKey.
+func NamedTransactionKey(name string) string {
+	if name == "" {
+		return TransactionKey
+	}
+	return TransactionKey + ":" + name
+}
+
+// InstallNamedDB Install a database under a name.
+// A function that returns the Interface type is passed in as a handle to the database.
+func (app *Application) InstallNamedDB(name string, f func() (db interface{})) {
+	if name == "" {
+		globalApp.Logger().Fatalf("[Freedom] InstallNamedDB: The name of the data source cannot be empty")
+	}
+	if app.dataSource(name) != nil {
+		globalApp.Logger().Fatalf("[Freedom] InstallNamedDB: Data source already installed :%v", name)
+	}
+	app.Database.sources = append(app.Database.sources, &dataSource{name: name, install: f})
+}
+
+// InstallReplicaDB Install a read replica of the database.
+// Repositories read from the replicas by FetchReadDB.
+func (app *Application) InstallReplicaDB(f func() (db interface{})) {
+	app.Database.primary.replicaInstalls = append(app.Database.primary.replicaInstalls, f)
+}
+
+// InstallNamedReplicaDB Install a read replica of the database installed under name.
+func (app *Application) InstallNamedReplicaDB(name string, f func() (db interface{})) {
+	source := app.dataSource(name)
+	if source == nil {
+		globalApp.Logger().Fatalf("[Freedom] InstallNamedReplicaDB: Data source is not installed :%v", name)
+	}
+	source.replicaInstalls = append(source.replicaInstalls, f)
+}
+
+// dataSource returns the named data source, nil if it has not been installed.
+// The default data source is returned if name is empty.
+func (app *Application) dataSource(name string) *dataSource {
+	if name == "" {
+		return &app.Database.primary
+	}
+	for _, source := range app.Database.sources {
+		if source.name == name {
+			return source
+		}
+	}
+	return nil
+}
+
+// namedDB returns the database handle of the data source.
+// The default data source is returned if name is empty.
+func (app *Application) namedDB(name string) interface{} {
+	if source := app.dataSource(name); source != nil {
+		return source.db
+	}
+	return nil
+}
+
+// primaryStoreKey returns the first-level cache key which marks the request
+// used the primary of the named data source.
+func primaryStoreKey(name string) string {
+	if name == "" {
+		return primaryKey
+	}
+	return primaryKey + ":" + name
+}
+
+// FetchNamedDB Gets the database handle installed under name for the worker.
+// The transaction of the worker on the same data source takes precedence.
+func FetchNamedDB(worker Worker, name string, db interface{}) error {
+	return fetchDB(worker, name, db)
+}
+
+// fetchDB fills db with the handle of the named data source. The transaction
+// handle of the same data source takes precedence if worker is not nil.
+// With replicas, the reads of a *gorm.DB go to the replicas until the request
+// writes, then the request reads its own writes from the primary.
+func fetchDB(worker Worker, name string, db interface{}) error {
+	source := globalApp.dataSource(name)
+	var resultDB interface{}
+	if source != nil {
+		resultDB = source.db
+	}
+	if worker != nil {
+		if transactionData := worker.Store().Get(NamedTransactionKey(name)); transactionData != nil {
+			resultDB = transactionData
+		} else if resultDB != nil && len(source.replicas) > 0 && !worker.Store().GetBoolDefault(primaryStoreKey(name), false) {
+			resultDB = routeReads(worker, name, source, resultDB)
+		}
+	}
+	if resultDB == nil || !fetchValue(db, withContext(worker, resultDB)) {
+		return dbNotFound(name)
+	}
+	return nil
+}
+
+// fetchReadDB fills db with a replica of the named data source. The primary is
+// used inside a transaction and after the request has written.
+func fetchReadDB(worker Worker, name string, db interface{}) error {
+	if worker != nil && (worker.Store().Get(NamedTransactionKey(name)) != nil || worker.Store().GetBoolDefault(primaryStoreKey(name), false)) {
+		return fetchDB(worker, name, db)
+	}
+
+	var resultDB interface{}
+	if source := globalApp.dataSource(name); source != nil {
+		resultDB = source.replica()
+	}
+	if resultDB == nil || !fetchValue(db, withContext(worker, resultDB)) {
+		return dbNotFound(name)
+	}
+	return nil
+}
+
+func dbNotFound(name string) error {
+	if name == "" {
+		return errors.New("DB not found, please install")
+	}
+	return fmt.Errorf("DB '%s' not found, please install", name)
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// tracingPlugin is the name of the GORM plugin of infra/tracing.
+const tracingPlugin = "freedom:tracing"
+
+// readRouterKey is the setting of the *gorm.DB returned by FetchDB which routes its reads.
+const readRouterKey = "freedom:read_router"
+
+// readRouter routes the reads of a request to the replicas until the request writes.
+type readRouter struct {
+	worker Worker
+	name   string
+	source *dataSource
+}
+
+// routeReads returns the primary handle whose reads go to the replicas, the
+// handles other than *gorm.DB are returned as they are.
+func routeReads(worker Worker, name string, source *dataSource, db interface{}) interface{} {
+	primary, ok := db.(*gorm.DB)
+	if !ok || source.router != primary {
+		return db
+	}
+	return primary.Set(readRouterKey, &readRouter{worker: worker, name: name, source: source}).Session(&gorm.Session{})
+}
+
+// registerReadRouter registers the callbacks of the read routing on the primary.
+func registerReadRouter(source *dataSource) {
+	primary, ok := source.db.(*gorm.DB)
+	if !ok || source.router == primary {
+		return
+	}
+	callback := primary.Callback()
+	callback.Query().Before("gorm:query").Register("freedom:read_router", routeQuery)
+	callback.Row().Before("gorm:row").Register("freedom:read_router", routeRow)
+	callback.Create().Register("freedom:read_router", pinPrimary)
+	callback.Update().Register("freedom:read_router", pinPrimary)
+	callback.Delete().Register("freedom:read_router", pinPrimary)
+	callback.Raw().Register("freedom:read_router", pinPrimary)
+	source.router = primary
+}
+
+func readRouterOf(db *gorm.DB) *readRouter {
+	value, ok := db.Get(readRouterKey)
+	if !ok {
+		return nil
+	}
+	router, _ := value.(*readRouter)
+	return router
+}
+
+// routeQuery sends the query to a replica, unless the request has written or the
+// query locks the rows.
+func routeQuery(db *gorm.DB) {
+	router := readRouterOf(db)
+	if router == nil || router.pinned() {
+		return
+	}
+	if _, locking := db.Statement.Clauses["FOR"]; locking {
+		return
+	}
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return
+	}
+	if replica, ok := router.source.replica().(*gorm.DB); ok {
+		db.Statement.ConnPool = replica.ConnPool
+	}
+}
+
+// routeRow sends the rows of a select to a replica, the other raw statements are writes.
+func routeRow(db *gorm.DB) {
+	router := readRouterOf(db)
+	if router == nil {
+		return
+	}
+	sql := strings.ToUpper(strings.TrimSpace(db.Statement.SQL.String()))
+	if sql != "" && !strings.HasPrefix(sql, "SELECT") {
+		router.pin()
+		return
+	}
+	routeQuery(db)
+}
+
+// pinPrimary sends the later reads of the request to the primary after a write.
+func pinPrimary(db *gorm.DB) {
+	if router := readRouterOf(db); router != nil {
+		router.pin()
+	}
+}
+
+func (router *readRouter) pin() {
+	router.worker.Store().Set(primaryStoreKey(router.name), true)
+}
+
+func (router *readRouter) pinned() bool {
+	return router.worker.Store().GetBoolDefault(primaryStoreKey(router.name), false)
+}
+
+// withContext returns db.WithContext with the worker context if the tracing plugin
+// is installed on db, so that the statements are traced under the request.
+func withContext(worker Worker, db interface{}) interface{} {
+	gormDB, ok := db.(*gorm.DB)
+	if !ok || worker == nil {
+		return db
+	}
+	if _, traced := gormDB.Config.Plugins[tracingPlugin]; !traced {
+		return db
+	}
+	return gormDB.WithContext(workerContext(worker))
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/8treenet/freedom/infra/requests"
+)
+
+// DeadlineHeader The header that carries the remaining budget of the request in milliseconds.
+// The budget is relative so that the clocks of the services do not need to agree.
+const DeadlineHeader = "x-request-deadline-ms"
+
+// ParseDeadline Returns the deadline of the budget in value, which was sent at start.
+// The value is ignored if it is not a number of milliseconds.
+func ParseDeadline(value string, start time.Time) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	budget, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || budget < 0 {
+		return time.Time{}, false
+	}
+	return start.Add(time.Duration(budget) * time.Millisecond), true
+}
+
+// DeadlineBudget Returns the value of DeadlineHeader for the deadline of ctx.
+// An expired deadline is sent as 0.
+func DeadlineBudget(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return "", false
+	}
+	budget := time.Until(deadline).Milliseconds()
+	if budget < 0 {
+		budget = 0
+	}
+	return strconv.FormatInt(budget, 10), true
+}
+
+// transferWorker sets the bus of the worker to the request, the traceparent is
+// sent with a new span id. If the worker has a deadline, the remaining budget is
+// sent too. The request carries the context of the worker.
+func transferWorker(work Worker, req requests.Request) requests.Request {
+	header := work.Bus().Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	req.SetHeader(header)
+	if tc, ok := work.Bus().TraceContext(); ok {
+		header.Set(TraceparentHeader, tc.Child().String())
+	}
+	if budget, ok := DeadlineBudget(work.Context()); ok {
+		header.Set(DeadlineHeader, budget)
+	}
+	req.WithContext(workerContext(work))
+	return req
+}
+
+// workerContext returns the context of the worker for the outgoing calls.
+// It is canceled at the deadline sent by the caller, but not when the client
+// of the request goes away. The values like the span are kept.
+func workerContext(work Worker) context.Context {
+	ctx := work.Context()
+	if ctx == nil {
+		return context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx
+	}
+	return context.WithoutCancel(ctx)
+}
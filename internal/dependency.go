@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// dependencyTag is the struct tag that excludes a field from the dependency check.
+	//  Client *http.Client `freedom:"-"`
+	dependencyTag = "freedom"
+)
+
+// The kinds of the nodes in the dependency graph.
+const (
+	kindController = "controller"
+	kindService    = "service"
+	kindFactory    = "factory"
+	kindRepository = "repository"
+	kindInfra      = "infra"
+	kindWorker     = "worker"
+)
+
+var internalPkgPath = reflect.TypeOf(Application{}).PkgPath()
+
+// dependencyNode is a bound type in the dependency graph.
+type dependencyNode struct {
+	Kind string `json:"kind"`
+	Type string `json:"type"`
+	// Single is true for the singleton infras.
+	Single bool `json:"single,omitempty"`
+	// Lifetime of the services, factories and repositories.
+	Lifetime string `json:"lifetime,omitempty"`
+	// Path is the route of the controllers.
+	Path string `json:"path,omitempty"`
+}
+
+// dependencyEdge is an injected field, From depends on To.
+type dependencyEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Field string `json:"field"`
+}
+
+// dependencyGraph is the graph of the bound types and their injected fields.
+// Problems are the fields that resolve to a binding but cannot be injected and
+// the circular dependencies. Warnings are the nil fields that no binding resolves.
+type dependencyGraph struct {
+	Nodes    []dependencyNode `json:"nodes"`
+	Edges    []dependencyEdge `json:"edges"`
+	Problems []string         `json:"problems,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// err returns the problems of the graph in one error, nil if there is none.
+func (graph *dependencyGraph) err() error {
+	if len(graph.Problems) == 0 {
+		return nil
+	}
+	return errors.New("\n\t" + strings.Join(graph.Problems, "\n\t"))
+}
+
+// buildDependencyGraph instantiates every bound service, factory and repository
+// once and resolves their fields the same way as the pools inject them.
+// Only the singleton infras have their infra fields injected, so the circular
+// dependencies are detected among them. The services, factories and repositories
+// cannot inject their own kind and cannot form a cycle.
+func (app *Application) buildDependencyGraph() *dependencyGraph {
+	graph := new(dependencyGraph)
+	for _, binding := range app.controllers {
+		t := reflect.TypeOf(binding.controller)
+		graph.Nodes = append(graph.Nodes, dependencyNode{Kind: kindController, Type: t.String(), Path: binding.path})
+		injectFields(reflect.ValueOf(binding.controller), func(field reflect.StructField, value reflect.Value) {
+			if target := resolveType(value.Type(), app.pool.creater); target != nil && field.IsExported() {
+				graph.Edges = append(graph.Edges, dependencyEdge{From: t.String(), To: target.String(), Field: field.Name})
+			}
+		})
+	}
+
+	check := func(kind string, t reflect.Type, creater interface{}, resolvers ...string) {
+		lifetime := app.lifetimeOf(kind, t)
+		graph.Nodes = append(graph.Nodes, dependencyNode{Kind: kind, Type: t.String(), Lifetime: lifetime.String()})
+		obj, err := callCreater(creater)
+		if err != nil {
+			graph.Problems = append(graph.Problems, fmt.Sprintf("%s %v: %v", kind, t, err))
+			return
+		}
+		app.checkFields(graph, t, lifetime, reflect.ValueOf(obj), resolvers)
+	}
+
+	for _, t := range sortedTypes(app.pool.creater) {
+		check(kindService, t, app.pool.creater[t], kindWorker, kindRepository, kindInfra, kindFactory)
+	}
+	for _, t := range sortedTypes(app.factoryPool.creater) {
+		check(kindFactory, t, app.factoryPool.creater[t], kindWorker, kindRepository, kindInfra)
+	}
+	for _, t := range sortedTypes(app.rpool.creater) {
+		check(kindRepository, t, app.rpool.creater[t], kindInfra)
+	}
+
+	singles, cycle := app.comPool.singleOrdered()
+	for _, com := range singles {
+		graph.Nodes = append(graph.Nodes, dependencyNode{Kind: kindInfra, Type: reflect.TypeOf(com).String(), Single: true})
+		allFields(com, func(value reflect.Value) {
+			if dep := app.comPool.single(value.Type()); dep != nil && dep != com {
+				graph.Edges = append(graph.Edges, dependencyEdge{From: reflect.TypeOf(com).String(), To: reflect.TypeOf(dep).String()})
+			}
+		})
+	}
+	if len(cycle) > 0 {
+		graph.Problems = append(graph.Problems, fmt.Sprintf("infra %v: circular dependency", cycle))
+	}
+	for _, t := range sortedTypes(app.comPool.instanceCreater) {
+		graph.Nodes = append(graph.Nodes, dependencyNode{Kind: kindInfra, Type: t.String()})
+	}
+	return graph
+}
+
+// checkFields resolves the nil pointer and interface fields of obj.
+// A field that no binding resolves is a warning, it may be set lazily. A field
+// that resolves must be exported, a singleton must not have a Worker field and
+// its dependencies must be singletons.
+func (app *Application) checkFields(graph *dependencyGraph, owner reflect.Type, lifetime Lifetime, obj reflect.Value, resolvers []string) {
+	injectFields(obj, func(field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get(dependencyTag) == "-" || !value.IsNil() {
+			return
+		}
+		name := owner.String() + "." + field.Name
+		kind, target := app.resolveField(value.Type(), resolvers)
+		if kind == "" {
+			graph.Warnings = append(graph.Warnings, fmt.Sprintf("%s (%v): no binding can be injected, tag it with `freedom:\"-\"` if it is set lazily", name, value.Type()))
+			return
+		}
+		if !field.IsExported() {
+			graph.Problems = append(graph.Problems, fmt.Sprintf("%s (%v): the field must be exported to be injected", name, value.Type()))
+			return
+		}
+		if lifetime == Singleton && kind == kindWorker {
+			graph.Problems = append(graph.Problems, fmt.Sprintf("%s (%v): the singleton must not have a Worker field", name, value.Type()))
+			return
+		}
+		if lifetime == Singleton && app.lifetimeOf(kind, target) != Singleton {
+			graph.Problems = append(graph.Problems, fmt.Sprintf("%s (%v): the singleton must not capture the %s %s %v", name, value.Type(), app.lifetimeOf(kind, target), kind, target))
+			return
+		}
+		if kind != kindWorker {
+			graph.Edges = append(graph.Edges, dependencyEdge{From: owner.String(), To: target.String(), Field: field.Name})
+		}
+	})
+}
+
+// resolveField returns the kind and the type of the binding that would be injected into t.
+func (app *Application) resolveField(t reflect.Type, resolvers []string) (string, reflect.Type) {
+	for _, kind := range resolvers {
+		var target reflect.Type
+		switch kind {
+		case kindWorker:
+			if t.Kind() == reflect.Interface && workerType.AssignableTo(t) {
+				return kind, workerType
+			}
+		case kindRepository:
+			target = resolveType(t, app.rpool.creater)
+		case kindFactory:
+			target = resolveType(t, app.factoryPool.creater)
+		case kindInfra:
+			if com := app.comPool.single(t); com != nil {
+				target = reflect.TypeOf(com)
+			} else {
+				target = resolveType(t, app.comPool.instanceCreater)
+			}
+		}
+		if target != nil {
+			return kind, target
+		}
+	}
+	return "", nil
+}
+
+// resolveType returns the bound type which is t or implements t.
+func resolveType(t reflect.Type, creaters map[reflect.Type]interface{}) reflect.Type {
+	if t.Kind() != reflect.Interface {
+		if _, ok := creaters[t]; ok {
+			return t
+		}
+		return nil
+	}
+	for _, bound := range sortedTypes(creaters) {
+		if bound.Implements(t) {
+			return bound
+		}
+	}
+	return nil
+}
+
+// injectFields calls call with the pointer and interface fields of val like
+// allFieldsFromValue. The fields of the embedded framework types are skipped.
+func injectFields(val reflect.Value, call func(reflect.StructField, reflect.Value)) {
+	destVal := indirect(val)
+	destType := destVal.Type()
+	if destType.Kind() != reflect.Struct {
+		return
+	}
+	for index := 0; index < destVal.NumField(); index++ {
+		field := destType.Field(index)
+		if field.Anonymous {
+			if field.Type.PkgPath() != internalPkgPath && field.Type.Kind() == reflect.Struct {
+				injectFields(destVal.Field(index), call)
+			}
+			continue
+		}
+		value := destVal.Field(index)
+		if kind := value.Kind(); kind != reflect.Ptr && kind != reflect.Interface {
+			continue
+		}
+		call(field, value)
+	}
+}
+
+// callCreater calls the bound function, a panic is returned as an error.
+func callCreater(creater interface{}) (result interface{}, e error) {
+	defer func() {
+		if perr := recover(); perr != nil {
+			e = fmt.Errorf("%v", perr)
+		}
+	}()
+	values := reflect.ValueOf(creater).Call([]reflect.Value{})
+	if len(values) == 0 || values[0].IsNil() {
+		return nil, errors.New("the binding function returns nil")
+	}
+	return values[0].Interface(), nil
+}
+
+// sortedTypes returns the keys of m ordered by the type name.
+func sortedTypes(m map[reflect.Type]interface{}) []reflect.Type {
+	result := make([]reflect.Type, 0, len(m))
+	for t := range m {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+	return result
+}
+
+// checkDependencies refuses to start if a field of the bound types resolves to
+// a binding that cannot be injected, the unresolved fields are logged.
+// Set conf.Other["dependency_check"] to false to skip the check.
+func (app *Application) checkDependencies(conf IrisConfiguration) {
+	if enable, ok := conf.Other["dependency_check"].(bool); ok && !enable {
+		return
+	}
+	graph := app.buildDependencyGraph()
+	for _, warning := range graph.Warnings {
+		app.Logger().Warnf("[Freedom] The dependency check found a nil field, %s", warning)
+	}
+	if err := graph.err(); err != nil {
+		app.Logger().Fatalf("[Freedom] The dependency check failed, set 'dependency_check' to false to skip it:%v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// inflight counts the workers that have not finished, the requests and the
+// goroutines of Go. A worker marked by DeferRecycle is counted in deferred from
+// the end of its request until Recycle is called.
+type inflight struct {
+	count    int64
+	deferred int64
+}
+
+func (i *inflight) add() {
+	atomic.AddInt64(&i.count, 1)
+}
+
+func (i *inflight) done() {
+	atomic.AddInt64(&i.count, -1)
+}
+
+func (i *inflight) len() int64 {
+	return atomic.LoadInt64(&i.count)
+}
+
+// deferRecycle moves a request that has ended from count to deferred.
+func (i *inflight) deferRecycle() {
+	atomic.AddInt64(&i.deferred, 1)
+	i.done()
+}
+
+func (i *inflight) deferredDone() {
+	atomic.AddInt64(&i.deferred, -1)
+}
+
+func (i *inflight) deferredLen() int64 {
+	return atomic.LoadInt64(&i.deferred)
+}
+
+// wait returns when all the workers have finished or ctx is done.
+// The DeferRecycle workers are not waited, see waitDeferred.
+func (i *inflight) wait(ctx context.Context) error {
+	return waitZero(ctx, i.len)
+}
+
+// waitDeferred returns when all the DeferRecycle workers are recycled or ctx is done.
+func (i *inflight) waitDeferred(ctx context.Context) error {
+	return waitZero(ctx, i.deferredLen)
+}
+
+func waitZero(ctx context.Context, count func() int64) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for count() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Draining Reports whether the application is shutting down.
+// The readiness endpoint reports draining once the shutdown begins.
+func (app *Application) Draining() bool {
+	return atomic.LoadInt32(&app.draining) == 1
+}
+
+// drain marks the application not ready, waits for the load balancer to notice,
+// runs the OnDrain hooks and then waits for the in-flight workers.
+func (app *Application) drain(ctx context.Context, period time.Duration) {
+	atomic.StoreInt32(&app.draining, 1)
+	if period > 0 {
+		timer := time.NewTimer(period)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	if err := app.lifecycle.run(ctx, OnDrain); err != nil {
+		app.Logger().Errorf("[Freedom] An error was encountered during the program shutdown, %v", err)
+	}
+	if err := app.inflight.wait(ctx); err != nil {
+		app.Logger().Errorf("[Freedom] %d workers did not finish during the program shutdown, %v", app.inflight.len(), err)
+	}
+}
+
+// waitDeferred waits for the DeferRecycle workers until they are recycled, at most timeout.
+func (app *Application) waitDeferred(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := app.inflight.waitDeferred(ctx); err != nil {
+		app.Logger().Errorf("[Freedom] %d DeferRecycle workers were not recycled during the program shutdown, call freedom.Recycle when they finish, %v", app.inflight.deferredLen(), err)
+	}
+}
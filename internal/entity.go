@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
 	"strings"
 
@@ -10,6 +11,10 @@ import (
 
 var _ Entity = (*entity)(nil)
 
+// EventIDHeader The header that carries the identity of the event in a message.
+// It is set by the producer of the event and is not passed on with the Bus.
+const EventIDHeader = "x-event-id"
+
 // DomainEvent Interface definition of domain events for subscription and publishing of entities.
 // To create a domain event, you must implement the interface's methods.
 type DomainEvent interface {
@@ -147,3 +152,21 @@ func (e *entity) GetSubEvents() (result []DomainEvent) {
 func (e *entity) RemoveAllSubEvent() {
 	e.subEvents = []DomainEvent{}
 }
+
+// SetEventPrototypes Sets the prototypes of the events from the Bus of the worker,
+// the events that have prototypes are kept as they are. EventIDHeader is not copied.
+func SetEventPrototypes(worker Worker, events ...DomainEvent) {
+	eventID := http.CanonicalHeaderKey(EventIDHeader)
+	for _, event := range events {
+		if len(event.GetPrototypes()) > 0 {
+			continue
+		}
+		prototypes := map[string]interface{}{}
+		for key, values := range worker.Bus().Header {
+			if len(values) > 0 && http.CanonicalHeaderKey(key) != eventID {
+				prototypes[key] = values[0]
+			}
+		}
+		event.SetPrototypes(prototypes)
+	}
+}
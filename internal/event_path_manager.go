@@ -4,31 +4,43 @@ import (
 	"reflect"
 )
 
+// EventMode The mode to process the messages of an event.
+type EventMode int
+
+const (
+	// EventSequential processes the messages of a partition one after the other.
+	EventSequential EventMode = iota
+	// EventConcurrent processes the messages concurrently.
+	EventConcurrent
+	// EventKeyOrdered processes the messages of a key in order and the keys concurrently.
+	EventKeyOrdered
+)
+
 func newEventPathManager() *eventPathManager {
 	return &eventPathManager{
-		eventsPath:       make(map[string]string),
-		eventsAddr:       make(map[string]string),
-		eventsInfraCom:   make(map[string]reflect.Type),
-		eventsSequential: make(map[string]bool),
+		eventsPath:     make(map[string]string),
+		eventsAddr:     make(map[string]string),
+		eventsInfraCom: make(map[string]reflect.Type),
+		eventsMode:     make(map[string]EventMode),
 	}
 }
 
 // eventPathManager.
 // Subscribe to the message conversion HTTP API.
 type eventPathManager struct {
-	eventsPath       map[string]string
-	eventsAddr       map[string]string
-	controllers      []interface{}
-	eventsInfraCom   map[string]reflect.Type
-	eventsSequential map[string]bool // 存储每个topic的串行/并行配置
+	eventsPath     map[string]string
+	eventsAddr     map[string]string
+	controllers    []interface{}
+	eventsInfraCom map[string]reflect.Type
+	eventsMode     map[string]EventMode // 存储每个topic的处理模式
 }
 
-func (msgBus *eventPathManager) addEvent(objectMethod, eventName string, sequential bool) {
+func (msgBus *eventPathManager) addEvent(objectMethod, eventName string, mode EventMode) {
 	if _, ok := msgBus.eventsAddr[eventName]; ok {
 		globalApp.Logger().Fatalf("[Freedom] ListenEvent: Event already bound :%v", eventName)
 	}
 	msgBus.eventsAddr[eventName] = objectMethod
-	msgBus.eventsSequential[eventName] = sequential
+	msgBus.eventsMode[eventName] = mode
 }
 func (msgBus *eventPathManager) addController(controller interface{}) {
 	msgBus.controllers = append(msgBus.controllers, controller)
@@ -50,14 +62,23 @@ func (msgBus *eventPathManager) EventsPath(infra interface{}) (msgs map[string]s
 
 // EventsSequential 返回每个topic的串行/并行配置
 func (msgBus *eventPathManager) EventsSequential(infra interface{}) (sequential map[string]bool) {
-	infraComType := reflect.TypeOf(infra)
 	sequential = make(map[string]bool)
-	for k, v := range msgBus.eventsSequential {
+	for k, v := range msgBus.EventsMode(infra) {
+		sequential[k] = v == EventSequential
+	}
+	return
+}
+
+// EventsMode 返回每个topic的处理模式
+func (msgBus *eventPathManager) EventsMode(infra interface{}) (modes map[string]EventMode) {
+	infraComType := reflect.TypeOf(infra)
+	modes = make(map[string]EventMode)
+	for k, v := range msgBus.eventsMode {
 		ty, ok := msgBus.eventsInfraCom[k]
 		if ok && ty != infraComType {
 			continue
 		}
-		sequential[k] = v
+		modes[k] = v
 	}
 	return
 }
@@ -8,16 +8,27 @@ import (
 func newFactoryPool() *factoryPool {
 	result := new(factoryPool)
 	result.creater = make(map[reflect.Type]interface{})
+	result.lifetimes = make(map[reflect.Type]Lifetime)
 	return result
 }
 
 // factoryPool .
 type factoryPool struct {
-	creater map[reflect.Type]interface{}
+	creater    map[reflect.Type]interface{}
+	lifetimes  map[reflect.Type]Lifetime
+	singletons singletons
 }
 
-func (pool *factoryPool) bind(outType reflect.Type, f interface{}) {
+func (pool *factoryPool) bind(outType reflect.Type, f interface{}, lifetime Lifetime) {
 	pool.creater[outType] = f
+	pool.lifetimes[outType] = lifetime
+}
+
+// singleton returns the singleton factory of type t.
+func (pool *factoryPool) singleton(t reflect.Type) (reflect.Value, error) {
+	return pool.singletons.get(t, func() (reflect.Value, error) {
+		return newSingleton(pool.creater[t], kindRepository, kindInfra)
+	})
 }
 
 // get .
@@ -58,35 +69,10 @@ func (pool *factoryPool) diFactory(factory interface{}, instance *serviceElement
 func (pool *factoryPool) diFactoryFromValue(value reflect.Value, instance *serviceElement) bool {
 	//如果是指针的成员变量
 	if value.Kind() == reflect.Ptr && value.IsZero() {
-		ok, newfield := pool.get(value.Type())
-		if !ok {
+		if !pool.exist(value.Type()) {
 			return false
 		}
-		if !value.CanSet() {
-			panic(fmt.Sprintf("[Freedom] This use factory object must be a capital variable: %v", value.Type().String()))
-		}
-		//创建实例并且注入基础设施组件和资源库
-		value.Set(newfield)
-		allFieldsFromValue(newfield, func(fieldValue reflect.Value) {
-			kind := fieldValue.Kind()
-			if kind == reflect.Interface && workerType.AssignableTo(fieldValue.Type()) && fieldValue.CanSet() {
-				//如果是运行时对象
-				instance.workers = append(instance.workers, fieldValue)
-				return
-			}
-
-			globalApp.rpool.diRepoFromValue(fieldValue, instance)
-			globalApp.comPool.diInfraFromValue(fieldValue)
-
-			if fieldValue.IsNil() {
-				return
-			}
-			if br, ok := fieldValue.Interface().(BeginRequest); ok {
-				instance.calls = append(instance.calls, br)
-			}
-		})
-		// globalApp.comPool.diInfra(factoryObj)
-		// globalApp.rpool.diRepo(factoryObj)
+		pool.inject(value, value.Type(), instance)
 		return true
 	}
 
@@ -97,35 +83,63 @@ func (pool *factoryPool) diFactoryFromValue(value reflect.Value, instance *servi
 			if !typeList[index].Implements(value.Type()) {
 				continue
 			}
-			ok, newfield := pool.get(typeList[index])
-			if !ok {
-				continue
-			}
-			if !value.CanSet() {
-				panic(fmt.Sprintf("[Freedom] This use factory object must be a capital variable: %v", value.Type().String()))
-			}
-			//创建实例并且注入基础设施组件和资源库
-			value.Set(newfield)
-			allFieldsFromValue(newfield, func(fieldValue reflect.Value) {
-				kind := fieldValue.Kind()
-				if kind == reflect.Interface && workerType.AssignableTo(fieldValue.Type()) && fieldValue.CanSet() {
-					//如果是运行时对象
-					instance.workers = append(instance.workers, fieldValue)
-					return
-				}
-
-				globalApp.rpool.diRepoFromValue(fieldValue, instance)
-				globalApp.comPool.diInfraFromValue(fieldValue)
-
-				if fieldValue.IsNil() {
-					return
-				}
-				if br, ok := fieldValue.Interface().(BeginRequest); ok {
-					instance.calls = append(instance.calls, br)
-				}
-			})
+			pool.inject(value, typeList[index], instance)
 			return true
 		}
 	}
 	return false
 }
+
+// inject sets value with the factory of type t according to its lifetime.
+func (pool *factoryPool) inject(value reflect.Value, t reflect.Type, instance *serviceElement) {
+	if !value.CanSet() {
+		panic(fmt.Sprintf("[Freedom] This use factory object must be a capital variable: %v", value.Type().String()))
+	}
+
+	switch pool.lifetimes[t] {
+	case Singleton:
+		factory, err := pool.singleton(t)
+		if err != nil {
+			panic(fmt.Sprintf("[Freedom] BindFactory: %v", err))
+		}
+		value.Set(factory)
+	case Transient:
+		pool.create(value, t, &serviceElement{})
+		//每个请求重新创建
+		instance.transients = append(instance.transients, func(rt Worker) {
+			transient := serviceElement{}
+			pool.create(value, t, &transient)
+			if br, ok := value.Interface().(BeginRequest); ok {
+				transient.calls = append(transient.calls, br)
+			}
+			globalApp.pool.beginRequest(rt, transient)
+		})
+	default:
+		pool.create(value, t, instance)
+	}
+}
+
+// create sets value with a new factory of type t.
+func (pool *factoryPool) create(value reflect.Value, t reflect.Type, instance *serviceElement) {
+	_, newfield := pool.get(t)
+	//创建实例并且注入基础设施组件和资源库
+	value.Set(newfield)
+	allFieldsFromValue(newfield, func(fieldValue reflect.Value) {
+		kind := fieldValue.Kind()
+		if kind == reflect.Interface && workerType.AssignableTo(fieldValue.Type()) && fieldValue.CanSet() {
+			//如果是运行时对象
+			instance.workers = append(instance.workers, fieldValue)
+			return
+		}
+
+		globalApp.rpool.diRepoFromValue(fieldValue, instance)
+		globalApp.comPool.diInfraFromValue(fieldValue)
+
+		if fieldValue.IsNil() || globalApp.lifetimeOfValue(fieldValue) != PerRequest {
+			return
+		}
+		if br, ok := fieldValue.Interface().(BeginRequest); ok {
+			instance.calls = append(instance.calls, br)
+		}
+	})
+}
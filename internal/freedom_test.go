@@ -1,13 +1,25 @@
 package internal
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	irisContext "github.com/8treenet/iris/v12/context"
+	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
 )
 
 type B struct {
@@ -159,3 +171,843 @@ func TestParseCallServiceFunc(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestNamedDataSource(t *testing.T) {
+	app := NewApplication()
+	removeTestDataSource(app, "reporting")
+	defer removeTestDataSource(app, "reporting")
+	app.InstallNamedDB("reporting", func() interface{} {
+		return &TestUser{Age: 1}
+	})
+	app.installDB()
+
+	repo := &Repository{worker: new(UnitTestImpl).newRuntime()}
+	var db *TestUser
+	if err := repo.FetchNamedDB("reporting", &db); err != nil || db.Age != 1 {
+		t.Fatal(db, err)
+	}
+
+	repo.Worker().Store().Set(NamedTransactionKey("orders"), &TestUser{Age: 2})
+	if err := repo.FetchNamedDB("reporting", &db); err != nil || db.Age != 1 {
+		t.Fatal("transaction of another data source leaked", db, err)
+	}
+
+	repo.Worker().Store().Set(NamedTransactionKey("reporting"), &TestUser{Age: 3})
+	if err := repo.FetchNamedDB("reporting", &db); err != nil || db.Age != 3 {
+		t.Fatal(db, err)
+	}
+	if err := repo.FetchOnlyNamedDB("reporting", &db); err != nil || db.Age != 1 {
+		t.Fatal(db, err)
+	}
+	if err := repo.FetchNamedDB("legacy", &db); err == nil {
+		t.Fatal("expected an error for an uninstalled data source")
+	}
+}
+
+func TestReplicaDataSource(t *testing.T) {
+	app := NewApplication()
+	removeTestDataSource(app, "orders")
+	defer removeTestDataSource(app, "orders")
+	app.InstallNamedDB("orders", func() interface{} {
+		return &TestUser{Age: 10}
+	})
+	for i := 11; i <= 12; i++ {
+		age := i
+		app.InstallNamedReplicaDB("orders", func() interface{} {
+			return &TestUser{Age: age}
+		})
+	}
+	app.dataSource("orders").booting()
+
+	repo := &Repository{worker: new(UnitTestImpl).newRuntime()}
+	var db *TestUser
+	seen := map[int]bool{}
+	for i := 0; i < 4; i++ {
+		if err := repo.FetchReadNamedDB("orders", &db); err != nil {
+			t.Fatal(err)
+		}
+		seen[db.Age] = true
+	}
+	if seen[10] || !seen[11] || !seen[12] {
+		t.Fatal("reads are not routed to the replicas", seen)
+	}
+
+	repo.Worker().Store().Set(NamedTransactionKey("orders"), &TestUser{Age: 20})
+	if err := repo.FetchReadNamedDB("orders", &db); err != nil || db.Age != 20 {
+		t.Fatal("reads inside a transaction must use the transaction", db, err)
+	}
+	repo.Worker().Store().Remove(NamedTransactionKey("orders"))
+	if err := repo.FetchReadNamedDB("orders", &db); err != nil || db.Age == 10 {
+		t.Fatal("reads before a write must use the replicas", db, err)
+	}
+	repo.Worker().Store().Set(primaryStoreKey("orders"), true)
+	if err := repo.FetchReadNamedDB("orders", &db); err != nil || db.Age != 10 {
+		t.Fatal("reads after a write must use the primary", db, err)
+	}
+}
+
+type testConnPool struct {
+	name  string
+	calls *[]string
+}
+
+var errTestConn = errors.New("test connection")
+
+func (pool *testConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errTestConn
+}
+
+func (pool *testConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	*pool.calls = append(*pool.calls, pool.name)
+	return nil, errTestConn
+}
+
+func (pool *testConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	*pool.calls = append(*pool.calls, pool.name)
+	return nil, errTestConn
+}
+
+func (pool *testConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+// removeTestDataSource uninstalls the data source installed by a test from the global application.
+func removeTestDataSource(app *Application, name string) {
+	sources := app.Database.sources[:0]
+	for _, source := range app.Database.sources {
+		if source.name != name {
+			sources = append(sources, source)
+		}
+	}
+	app.Database.sources = sources
+}
+
+func TestGormReadRouting(t *testing.T) {
+	app := NewApplication()
+	var calls []string
+	open := func(name string) interface{} {
+		db, err := gorm.Open(mysql.New(mysql.Config{Conn: &testConnPool{name: name, calls: &calls}, SkipInitializeWithVersion: true}),
+			&gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	app.InstallNamedDB("routed", func() interface{} { return open("primary") })
+	app.InstallNamedReplicaDB("routed", func() interface{} { return open("replica") })
+	defer removeTestDataSource(app, "routed")
+	app.dataSource("routed").booting()
+
+	repo := &Repository{worker: new(UnitTestImpl).newRuntime()}
+	run := func(fun func(db *gorm.DB)) string {
+		calls = calls[:0]
+		var db *gorm.DB
+		if err := repo.FetchNamedDB("routed", &db); err != nil {
+			t.Fatal(err)
+		}
+		fun(db)
+		return strings.Join(calls, ",")
+	}
+	find := func(db *gorm.DB) {
+		db.Find(&[]TestUser{})
+	}
+
+	if got := run(find); got != "replica" {
+		t.Fatal("reads must use the replicas", got)
+	}
+	if got := run(func(db *gorm.DB) { db.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&[]TestUser{}) }); got != "primary" {
+		t.Fatal("locking reads must use the primary", got)
+	}
+	if got := run(find); got != "replica" {
+		t.Fatal("reads must use the replicas", got)
+	}
+	if got := run(func(db *gorm.DB) { db.Create(&TestUser{UserName: "freedom"}) }); got != "primary" {
+		t.Fatal("writes must use the primary", got)
+	}
+	if got := run(find); got != "primary" {
+		t.Fatal("reads after a write must use the primary", got)
+	}
+}
+
+type testHealthSource struct {
+	err error
+}
+
+func (source *testHealthSource) HealthCheck(ctx context.Context) error {
+	return source.err
+}
+
+func TestHealth(t *testing.T) {
+	app := NewApplication()
+	source := &testHealthSource{}
+	app.InstallCustom(func() interface{} {
+		return source
+	})
+	app.other.booting()
+
+	report := app.Health(context.Background())
+	if report.Status != HealthUp {
+		t.Fatal("the application must be up", report)
+	}
+
+	source.err = errors.New("connection refused")
+	report = app.Health(context.Background())
+	if report.Status != HealthDown {
+		t.Fatal("the application must be down", report)
+	}
+	for _, component := range report.Components {
+		if component.Name == "custom:internal.testHealthSource" && component.Error == "connection refused" {
+			return
+		}
+	}
+	t.Fatal("the component is not reported", report)
+}
+
+func TestLifecycle(t *testing.T) {
+	l := newLifecycle()
+	var calls []string
+	hook := func(name string, phase LifecyclePhase, dependsOn ...string) {
+		l.register(LifecycleHook{Name: name, Phase: phase, DependsOn: dependsOn, Func: func(ctx context.Context) error {
+			calls = append(calls, name)
+			return nil
+		}})
+	}
+	hook("producer", OnStart, "client")
+	hook("client", OnStart)
+	hook("client", OnStop)
+	hook("producer", OnStop, "client")
+	hook("consumer", OnStop, "producer")
+	l.register(LifecycleHook{Name: "slow", Phase: OnStop, Timeout: 10 * time.Millisecond, Func: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+	l.register(LifecycleHook{Name: "panic", Phase: OnStop, Func: func(ctx context.Context) error {
+		panic("closed")
+	}})
+
+	if err := l.run(context.Background(), OnStart); err != nil {
+		t.Fatal(err)
+	}
+	err := l.run(context.Background(), OnStop)
+	if err == nil || !strings.Contains(err.Error(), "'slow'") || !strings.Contains(err.Error(), "'panic'") {
+		t.Fatal("the errors of the hooks are not collected", err)
+	}
+	if fmt.Sprint(calls) != "[client producer consumer producer client]" {
+		t.Fatal("the hooks are not ordered", calls)
+	}
+}
+
+func TestStopBudget(t *testing.T) {
+	app := NewApplication()
+	defer func() {
+		app.lifecycle = newLifecycle()
+		app.draining = 0
+		app.background, app.backgroundCancel = context.WithCancel(context.Background())
+	}()
+	stopped := make(chan error, 1)
+	app.RegisterHook(LifecycleHook{Name: "producer", Phase: OnStop, Func: func(ctx context.Context) error {
+		stopped <- ctx.Err()
+		return nil
+	}})
+
+	//The drain uses all of the shutdown budget
+	app.stop(20*time.Millisecond, time.Second, time.Second, time.Second)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal("the OnStop hooks must have their own budget", err)
+		}
+	default:
+		t.Fatal("the OnStop hooks must run after the drain timed out")
+	}
+}
+
+func TestDrainInflight(t *testing.T) {
+	app := NewApplication()
+	started, release := make(chan struct{}), make(chan struct{})
+	work := new(UnitTestImpl).newRuntime()
+	Go(work, func(Worker) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := app.inflight.wait(ctx); err == nil {
+		t.Fatal("the shutdown must wait for the background worker")
+	}
+
+	close(release)
+	if err := app.inflight.wait(context.Background()); err != nil || app.inflight.len() != 0 {
+		t.Fatal("the finished worker must not be waited", err, app.inflight.len())
+	}
+}
+
+func TestDrainDeferRecycle(t *testing.T) {
+	app := NewApplication()
+	ctx := irisContext.NewContext(app.IrisApp)
+	ctx.ResetRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+	held := make(chan Worker, 1)
+	ctx.Do(irisContext.Handlers{newWorkerHandle(), func(ctx irisContext.Context) {
+		work := ctx.Values().Get(WorkerKey).(Worker)
+		work.DeferRecycle()
+		held <- work
+	}})
+	work := <-held
+
+	if err := app.inflight.wait(context.Background()); err != nil || app.inflight.len() != 0 {
+		t.Fatal("the server must not wait for the DeferRecycle worker after its request", err)
+	}
+	timeout, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := app.inflight.waitDeferred(timeout); err == nil {
+		t.Fatal("the shutdown must wait for the DeferRecycle worker in use")
+	}
+
+	Recycle(work)
+	Recycle(work)
+	if err := app.inflight.waitDeferred(context.Background()); err != nil || app.inflight.deferredLen() != 0 {
+		t.Fatal("the recycled DeferRecycle worker must not be waited", err, app.inflight.deferredLen())
+	}
+
+	//A worker recycled before its request ends is not handed over
+	ctx.Do(irisContext.Handlers{newWorkerHandle(), func(ctx irisContext.Context) {
+		work := ctx.Values().Get(WorkerKey).(Worker)
+		work.DeferRecycle()
+		Recycle(work)
+	}})
+	if app.inflight.len() != 0 || app.inflight.deferredLen() != 0 {
+		t.Fatal("the worker recycled during its request must not be counted", app.inflight.len(), app.inflight.deferredLen())
+	}
+}
+
+func TestWorkerGo(t *testing.T) {
+	app := NewApplication()
+	work := new(UnitTestImpl).newRuntime()
+	work.Bus().Add("x-user", "1")
+	work.Store().Set("key", "value")
+	work.Store().Set(TransactionKey, "tx")
+
+	result := make(chan Worker, 1)
+	Go(work, func(background Worker) {
+		result <- background
+	})
+	background := <-result
+	if background == Worker(work) || background.Bus().Get("x-user") != "1" || background.Store().GetString("key") != "value" {
+		t.Fatal("the background worker must clone the bus and the store")
+	}
+	if background.Store().Get(TransactionKey) != nil {
+		t.Fatal("the background worker must not share the transaction")
+	}
+	if err := app.inflight.wait(context.Background()); err != nil || background.Context().Err() == nil {
+		t.Fatal("the background worker must be recycled when the function returns", err)
+	}
+
+	Go(work, func(Worker) {
+		panic("background")
+	})
+	if err := app.inflight.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	//The request has ended and its context is recycled
+	work.ctx = nil
+	type requestKey struct{}
+	requestCtx, requestCancel := context.WithCancel(context.WithValue(context.Background(), requestKey{}, "request"))
+	work.WithContext(requestCtx)
+	detached := Detach(work)
+	requestCancel()
+	if app.inflight.len() != 0 {
+		t.Fatal("the shutdown must not wait for a detached worker")
+	}
+	if detached.Context().Err() != nil || detached.Context().Value(requestKey{}) != "request" {
+		t.Fatal("the detached worker must keep the values of the request but not its cancellation")
+	}
+	app.backgroundCancel()
+	<-detached.Context().Done()
+	app.background, app.backgroundCancel = context.WithCancel(context.Background())
+}
+
+func TestDeadline(t *testing.T) {
+	NewApplication()
+	if _, ok := ParseDeadline("abc", time.Now()); ok {
+		t.Fatal("an invalid budget must be ignored")
+	}
+	if budget, ok := DeadlineBudget(context.Background()); ok {
+		t.Fatal("a context without deadline has no budget", budget)
+	}
+
+	rt := new(UnitTestImpl).newRuntime()
+	request := rt.IrisContext().Request().Clone(context.Background())
+	request.Header = make(http.Header)
+	request.Header.Set(DeadlineHeader, "5000")
+	request.Header.Set("x-request-id", "1")
+	rt.IrisContext().ResetRequest(request)
+
+	work := newWorker(rt.IrisContext())
+	deadline, ok := work.Context().Deadline()
+	if !ok || time.Until(deadline) > 5*time.Second || time.Until(deadline) < 4*time.Second {
+		t.Fatal("the worker context must expire at the deadline of the caller", deadline)
+	}
+	if _, ok := work.IrisContext().Request().Context().Deadline(); !ok || work.Bus().Get(DeadlineHeader) != "" {
+		t.Fatal("the request must have the deadline and the bus must not keep the budget")
+	}
+
+	repo := &Repository{worker: work}
+	req := repo.NewHTTPRequest("http://127.0.0.1")
+	budget, err := strconv.Atoi(req.Header().Get(DeadlineHeader))
+	if err != nil || budget > 5000 || budget < 4000 || req.Header().Get("x-request-id") != "1" {
+		t.Fatal("the remaining budget must be sent", budget, err)
+	}
+	if req.Context().Done() == nil || work.Bus().Get(DeadlineHeader) != "" {
+		t.Fatal("the request must be canceled with the worker")
+	}
+
+	work.cancel()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if budget, _ := DeadlineBudget(ctx); budget != "0" {
+		t.Fatal("an expired deadline must be sent as 0", budget)
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tc, ok := ParseTraceparent(value)
+	if !ok || tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || !tc.Sampled() || tc.String() != value {
+		t.Fatal("the traceparent must be parsed", tc, ok)
+	}
+	for _, invalid := range []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Fatal("the traceparent must be invalid", invalid)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Fatal("the future versions must be parsed")
+	}
+	if child := tc.Child(); child.TraceID != tc.TraceID || child.SpanID == tc.SpanID {
+		t.Fatal("the child must be a new span of the trace", child)
+	}
+	if tc := NewTraceContextWithID("4bf92f3577b34da6a3ce929d0e0e4736"); tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatal("the trace id must be used", tc)
+	}
+
+	bus := newBus(make(http.Header))
+	bus.Set(BaggageHeader, "userId=alice;ttl=1, tenant=a%20b")
+	if bus.BaggageItem("userId") != "alice" || bus.BaggageItem("tenant") != "a b" {
+		t.Fatal("the baggage must be parsed", bus.BaggageItems())
+	}
+	bus.SetBaggageItem("tenant", "c,d")
+	bus.SetBaggageItem("region", "eu")
+	bus.DelBaggageItem("userId")
+	if bus.Get(BaggageHeader) != "tenant=c%2Cd,region=eu" || bus.BaggageItem("tenant") != "c,d" {
+		t.Fatal("the baggage must be encoded", bus.Get(BaggageHeader))
+	}
+	bus.SetBaggageItem("userId", "bob")
+	bus.Set(BaggageHeader, "userId=bob;ttl=1")
+	bus.SetBaggageItem("userId", "carol")
+	if bus.Get(BaggageHeader) != "userId=carol;ttl=1" {
+		t.Fatal("the properties must be kept", bus.Get(BaggageHeader))
+	}
+
+	NewApplication()
+	work := new(UnitTestImpl).newRuntime()
+	work.Bus().SetTraceContext(tc)
+	req := (&Repository{worker: work}).NewHTTPRequest("http://127.0.0.1")
+	sent, ok := ParseTraceparent(req.Header().Get(TraceparentHeader))
+	if !ok || sent.TraceID != tc.TraceID || sent.SpanID == tc.SpanID || work.Bus().Get(TraceparentHeader) != value {
+		t.Fatal("the outgoing request must be a new span", sent)
+	}
+}
+
+func TestCronSchedule(t *testing.T) {
+	at := func(value string) time.Time {
+		result, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	for _, c := range []struct{ spec, from, next string }{
+		{"*/15 * * * *", "2026-03-01 10:07:30", "2026-03-01 10:15:00"},
+		{"0 9-17/4 * * mon-fri", "2026-03-06 17:30:00", "2026-03-09 09:00:00"},
+		{"30 * * * * *", "2026-03-01 10:07:30", "2026-03-01 10:08:30"},
+		{"0 0 29 2 *", "2026-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 1 * 7", "2026-03-02 00:00:00", "2026-03-08 00:00:00"},
+		{"@daily", "2026-12-31 23:59:59", "2027-01-01 00:00:00"},
+		{"@every 90s", "2026-03-01 10:07:30", "2026-03-01 10:09:00"},
+	} {
+		sched, err := parseSchedule(c.spec)
+		if err != nil {
+			t.Fatal(c.spec, err)
+		}
+		if next := sched.next(at(c.from)); !next.Equal(at(c.next)) {
+			t.Fatal(c.spec, "the next run must be", c.next, next)
+		}
+	}
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every 10ms", "@every x"} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Fatal("the spec must be invalid", spec)
+		}
+	}
+}
+
+type testJobService struct {
+	Worker Worker
+	calls  int32
+}
+
+func (service *testJobService) Run(action string) error {
+	atomic.AddInt32(&service.calls, 1)
+	switch action {
+	case "error":
+		return errors.New("job")
+	case "panic":
+		panic("job")
+	case "wait":
+		<-service.Worker.Context().Done()
+		return service.Worker.Context().Err()
+	}
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	app := NewApplication()
+	service := new(testJobService)
+	app.BindService(func() *testJobService {
+		return service
+	})
+
+	s := newScheduler()
+	job := func(action string, conf ...*JobConfig) *job {
+		if err := s.bind("@every 1s", func(service *testJobService) error {
+			return service.Run(action)
+		}, conf...); err != nil {
+			t.Fatal(err)
+		}
+		return s.jobs[len(s.jobs)-1]
+	}
+	for action, want := range map[string]string{"ok": jobOK, "error": jobError, "panic": jobPanic} {
+		if result, _ := s.run(context.Background(), job(action)); result != want {
+			t.Fatal("the result must be", want, result)
+		}
+	}
+	if result, err := s.run(context.Background(), job("wait", &JobConfig{Timeout: 20 * time.Millisecond})); result != jobTimeout || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("the job must time out", result, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := job("wait", &JobConfig{Name: "overlap"})
+	atomic.StoreInt32(&service.calls, 0)
+	s.trigger(ctx, waiting)
+	s.trigger(ctx, waiting)
+	cancel()
+	s.wg.Wait()
+	if waiting.name != "overlap" || atomic.LoadInt32(&service.calls) != 1 || atomic.LoadInt32(&waiting.running) != 0 {
+		t.Fatal("the job must not overlap", waiting.running)
+	}
+
+	s.jobs = nil
+	atomic.StoreInt32(&service.calls, 0)
+	if err := s.bind("* * * * * *", func(service *testJobService) error {
+		return service.Run("wait")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.start()
+	for deadline := time.Now().Add(3 * time.Second); atomic.LoadInt32(&service.calls) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the job must run on schedule")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := s.stop(context.Background()); err != nil || atomic.LoadInt32(&service.calls) != 1 {
+		t.Fatal("the running job must be stopped", err, service.calls)
+	}
+	if err := s.bind("@every 1s", func(service *testJobService) {}); err == nil {
+		t.Fatal("the job must return an error")
+	}
+}
+
+type testElector struct {
+	leader  bool
+	watcher func(bool)
+}
+
+func (elector *testElector) IsLeader() bool { return elector.leader }
+
+func (elector *testElector) FencingToken() (int64, bool) { return 7, elector.leader }
+
+func (elector *testElector) Watch(f func(bool)) { elector.watcher = f }
+
+func (elector *testElector) set(leader bool) {
+	elector.leader = leader
+	elector.watcher(leader)
+}
+
+func TestLeaderOnly(t *testing.T) {
+	var starts, stops int32
+	l := newLifecycle()
+	l.electLeader(true)
+	l.register(LifecycleHook{Phase: OnReady, LeaderOnly: true, Func: func(ctx context.Context) error {
+		atomic.AddInt32(&starts, 1)
+		return nil
+	}})
+	l.register(LifecycleHook{Phase: OnDrain, LeaderOnly: true, Func: func(ctx context.Context) error {
+		atomic.AddInt32(&stops, 1)
+		return nil
+	}})
+	l.run(context.Background(), OnStart)
+	l.run(context.Background(), OnReady)
+	if starts != 0 || l.leadership().Err() == nil {
+		t.Fatal("the leader only hook must wait for the leadership", starts)
+	}
+	l.setLeader(true)
+	l.setLeader(true)
+	if starts != 1 || l.leadership().Err() != nil {
+		t.Fatal("the leader only hook must run when the instance becomes the leader", starts)
+	}
+	leadership := l.leadership()
+	l.setLeader(false)
+	if stops != 1 || leadership.Err() == nil {
+		t.Fatal("the leader only hook must stop when the leadership is lost", stops)
+	}
+	l.setLeader(true)
+	l.run(context.Background(), OnDrain)
+	l.setLeader(false)
+	if starts != 2 || stops != 2 {
+		t.Fatal("the leader only hooks must follow the leadership", starts, stops)
+	}
+
+	//A slow hook does not block the elector, it is canceled when the leadership is lost
+	l = newLifecycle()
+	l.electLeader(true)
+	started, stopped := make(chan struct{}), make(chan error, 1)
+	l.register(LifecycleHook{Phase: OnReady, LeaderOnly: true, Func: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil
+	}})
+	l.run(context.Background(), OnReady)
+	//The canceled hook is reported
+	report := func(err error) {}
+	l.changeLeader(true, report)
+	<-started
+	l.changeLeader(false, report)
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Fatal("the leader only hook must be canceled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the leader only hook must be canceled when the leadership is lost")
+	}
+
+	app := NewApplication()
+	elector := new(testElector)
+	app.InstallLeaderElector(elector)
+	defer app.InstallLeaderElector(nil)
+
+	service := new(testJobService)
+	app.BindService(func() *testJobService {
+		return service
+	})
+	tokens := make(chan interface{}, 2)
+	s := newScheduler()
+	s.bind("@every 1s", func(service *testJobService) error {
+		tokens <- service.Worker.Store().Get(FencingTokenKey)
+		<-service.Worker.Context().Done()
+		return nil
+	}, &JobConfig{LeaderOnly: true})
+
+	s.trigger(context.Background(), s.jobs[0])
+	elector.set(true)
+	s.trigger(context.Background(), s.jobs[0])
+	if <-tokens != int64(7) {
+		t.Fatal("the leader only job must run on the leader with the fencing token")
+	}
+	elector.set(false)
+	s.wg.Wait()
+	if len(tokens) != 0 {
+		t.Fatal("the leader only job must run on the leader only")
+	}
+}
+
+type testDepRepo interface {
+	Get() string
+}
+
+type testDepRepoImpl struct {
+	Repository
+}
+
+func (repo *testDepRepoImpl) Get() string { return "" }
+
+type testDepService struct {
+	Worker  Worker
+	Repo    testDepRepo
+	Missing fmt.Stringer
+	Skipped fmt.Stringer `freedom:"-"`
+	repo    *testDepRepoImpl
+	mu      *sync.Mutex
+}
+
+func TestDependencyGraph(t *testing.T) {
+	app := &Application{pool: newServicePool(), rpool: newRepoPool(), factoryPool: newFactoryPool(), comPool: newInfraPool()}
+	app.BindService(func() *testDepService {
+		return &testDepService{}
+	})
+	app.BindRepository(func() *testDepRepoImpl {
+		return &testDepRepoImpl{}
+	})
+
+	graph := app.buildDependencyGraph()
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 || graph.Edges[0].Field != "Repo" {
+		t.Fatal("the graph is not built", graph.Nodes, graph.Edges)
+	}
+	err := graph.err()
+	if err == nil || len(graph.Problems) != 1 || !strings.Contains(err.Error(), "testDepService.repo") {
+		t.Fatal("the field that cannot be injected is not reported", graph.Problems)
+	}
+	if len(graph.Warnings) != 2 || !strings.Contains(graph.Warnings[0], "testDepService.Missing") || !strings.Contains(graph.Warnings[1], "testDepService.mu") {
+		t.Fatal("the unresolved fields must be warnings", graph.Warnings)
+	}
+
+	dot, err := app.Graph("dot")
+	if err != nil || !strings.Contains(string(dot), `"*internal.testDepService" -> "*internal.testDepRepoImpl" [label="Repo"]`) {
+		t.Fatal("the dot graph is not rendered", string(dot), err)
+	}
+	if _, err := app.Graph("xml"); err == nil {
+		t.Fatal("the unsupported format must fail")
+	}
+}
+
+type testGenericService struct {
+	Worker Worker
+}
+
+type testGenericSource struct {
+	Name string
+}
+
+func TestGeneric(t *testing.T) {
+	app := NewApplication()
+	BindService(app, func() *testGenericService {
+		return &testGenericService{}
+	})
+	app.InstallCustom(func() interface{} {
+		return &testGenericSource{Name: "generic"}
+	})
+	app.other.booting()
+
+	work := new(UnitTestImpl).newRuntime()
+	service, err := ServiceOf[*testGenericService](work)
+	if err != nil || service.Worker != work {
+		t.Fatal("the service is not fetched", service, err)
+	}
+	if _, err := ServiceOf[*TestUser](work); err == nil {
+		t.Fatal("the unbound service must fail")
+	}
+
+	source, err := CustomOf[*testGenericSource]()
+	if err != nil || source.Name != "generic" {
+		t.Fatal("the custom data source is not fetched", source, err)
+	}
+	if _, err := CustomOf[*TestUser](); err == nil {
+		t.Fatal("the uninstalled custom data source must fail")
+	}
+}
+
+type testLifetimeRepo struct {
+	Repository
+}
+
+type testTransientRepo struct {
+	Repository
+}
+
+type testSingletonService struct {
+	Repo *testLifetimeRepo
+}
+
+type testWorkerSingleton struct {
+	Worker Worker
+}
+
+type testPerRequestService struct {
+	Repo *testTransientRepo
+}
+
+func TestLifetime(t *testing.T) {
+	app := NewApplication()
+	BindRepository(app, func() *testLifetimeRepo { return &testLifetimeRepo{} }, Singleton)
+	BindRepository(app, func() *testTransientRepo { return &testTransientRepo{} }, Transient)
+	BindService(app, func() *testSingletonService { return &testSingletonService{} }, Singleton)
+	BindService(app, func() *testWorkerSingleton { return &testWorkerSingleton{} }, Singleton)
+	BindService(app, func() *testPerRequestService { return &testPerRequestService{} })
+
+	first, err := ServiceOf[*testSingletonService](new(UnitTestImpl).newRuntime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := ServiceOf[*testSingletonService](new(UnitTestImpl).newRuntime())
+	if first != second || first.Repo == nil || first.Repo.Worker() != nil {
+		t.Fatal("the singleton must be shared and must not have a worker", first, second)
+	}
+	if _, err := ServiceOf[*testWorkerSingleton](new(UnitTestImpl).newRuntime()); err == nil || !strings.Contains(err.Error(), "Worker field") {
+		t.Fatal("the singleton with a Worker field must fail", err)
+	}
+
+	work := new(UnitTestImpl).newRuntime()
+	service, _ := ServiceOf[*testPerRequestService](work)
+	repo := service.Repo
+	if repo.Worker() != work {
+		t.Fatal("the transient repository must have the worker")
+	}
+	for _, element := range work.freeServices {
+		app.pool.free(element)
+	}
+	work = new(UnitTestImpl).newRuntime()
+	service, _ = ServiceOf[*testPerRequestService](work)
+	if service.Repo == repo || service.Repo.Worker() != work {
+		t.Fatal("the transient repository must be created for every request")
+	}
+}
+
+type testPrototypeEvent struct {
+	prototypes map[string]interface{}
+}
+
+func (e *testPrototypeEvent) Topic() string                          { return "test" }
+func (e *testPrototypeEvent) SetPrototypes(m map[string]interface{}) { e.prototypes = m }
+func (e *testPrototypeEvent) GetPrototypes() map[string]interface{}  { return e.prototypes }
+func (e *testPrototypeEvent) Marshal() ([]byte, error)               { return nil, nil }
+func (e *testPrototypeEvent) Unmarshal([]byte) error                 { return nil }
+func (e *testPrototypeEvent) Identity() string                       { return "1" }
+func (e *testPrototypeEvent) SetIdentity(string)                     {}
+
+func TestSetEventPrototypes(t *testing.T) {
+	NewApplication()
+	work := new(UnitTestImpl).newRuntime()
+	work.Bus().Set("x-request-id", "abc")
+	work.Bus().Set(EventIDHeader, "consumed")
+
+	event := new(testPrototypeEvent)
+	kept := &testPrototypeEvent{prototypes: map[string]interface{}{"x-request-id": "kept"}}
+	SetEventPrototypes(work, event, kept)
+	if event.prototypes["X-Request-Id"] != "abc" || kept.prototypes["x-request-id"] != "kept" {
+		t.Fatalf("prototypes = %v, %v", event.prototypes, kept.prototypes)
+	}
+	if len(event.prototypes) != 1 {
+		t.Fatalf("the event id of the consumed message is passed on, prototypes = %v", event.prototypes)
+	}
+}
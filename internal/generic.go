@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ServiceOf Returns the service of type T for the worker.
+// T is the pointer type returned by the function bound with BindService.
+func ServiceOf[T any](work Worker) (result T, e error) {
+	rt, ok := work.(*worker)
+	if !ok {
+		return result, fmt.Errorf("[Freedom] ServiceOf: The worker is not created by freedom, %T", work)
+	}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	defer func() {
+		if perr := recover(); perr != nil {
+			e = fmt.Errorf("[Freedom] ServiceOf: %v", perr)
+		}
+	}()
+
+	newService, err := globalApp.pool.create(rt, t)
+	if err != nil {
+		return result, err
+	}
+	rt.freeServices = append(rt.freeServices, newService)
+	return newService.(serviceElement).serviceObject.(T), nil
+}
+
+// InfraOf Returns the infra of type T for the worker, T can be an interface
+// implemented by a bound infra.
+func InfraOf[T any](work Worker) (result T, e error) {
+	rt, ok := work.(*worker)
+	if !ok {
+		return result, fmt.Errorf("[Freedom] InfraOf: The worker is not created by freedom, %T", work)
+	}
+	if !globalApp.comPool.get(rt, reflect.ValueOf(&result).Elem()) {
+		return result, fmt.Errorf("[Freedom] InfraOf: No dependency injection was found for the infra, %v", reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return result, nil
+}
+
+// SingleInfraOf Returns the singleton infra of type T.
+func SingleInfraOf[T any]() (result T, e error) {
+	if !globalApp.comPool.FetchSingleInfra(reflect.ValueOf(&result).Elem()) {
+		return result, fmt.Errorf("[Freedom] SingleInfraOf: The singleton infra was not found, %v", reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return result, nil
+}
+
+// CustomOf Returns the custom data source of type T installed by InstallCustom.
+func CustomOf[T any]() (result T, e error) {
+	if !globalApp.other.fetch(reflect.ValueOf(&result).Elem()) {
+		return result, fmt.Errorf("[Freedom] CustomOf: The custom data source was not found, %v", reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return result, nil
+}
+
+// RepositoryOf Returns the repository of type T for the unit test, T can be
+// an interface implemented by a bound repository.
+func RepositoryOf[T any](test UnitTest) (result T, e error) {
+	u, ok := test.(*UnitTestImpl)
+	if !ok {
+		return result, fmt.Errorf("[Freedom] RepositoryOf: The unit test is not created by freedom, %T", test)
+	}
+	return result, u.fetchRepository(reflect.ValueOf(&result).Elem())
+}
+
+// FactoryOf Returns the factory of type T for the unit test.
+func FactoryOf[T any](test UnitTest) (result T, e error) {
+	u, ok := test.(*UnitTestImpl)
+	if !ok {
+		return result, fmt.Errorf("[Freedom] FactoryOf: The unit test is not created by freedom, %T", test)
+	}
+	return result, u.fetchFactory(reflect.ValueOf(&result).Elem())
+}
+
+// BindService Binds a function that creates the service of type *T.
+// The function is checked at compile time instead of by reflection.
+// The optional lifetime is PerRequest by default.
+func BindService[T any](initiator Initiator, f func() *T, lifetime ...Lifetime) {
+	app, ok := initiator.(*Application)
+	if !ok {
+		initiator.BindService(f, lifetime...)
+		return
+	}
+	app.pool.bind(reflect.TypeOf((*T)(nil)), f, parseLifetime(lifetime))
+}
+
+// BindRepository Binds a function that creates the repository of type *T.
+func BindRepository[T any](initiator Initiator, f func() *T, lifetime ...Lifetime) {
+	app, ok := initiator.(*Application)
+	if !ok {
+		initiator.BindRepository(f, lifetime...)
+		return
+	}
+	app.rpool.bind(reflect.TypeOf((*T)(nil)), f, parseLifetime(lifetime))
+}
+
+// BindFactory Binds a function that creates the factory of type *T.
+func BindFactory[T any](initiator Initiator, f func() *T, lifetime ...Lifetime) {
+	app, ok := initiator.(*Application)
+	if !ok {
+		initiator.BindFactory(f, lifetime...)
+		return
+	}
+	app.factoryPool.bind(reflect.TypeOf((*T)(nil)), f, parseLifetime(lifetime))
+}
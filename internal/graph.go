@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// GraphEnv is the environment variable that makes Run print the dependency
+	// graph in the format of its value ("json" or "dot") and return without serving.
+	// It is set by the 'freedom graph' command.
+	GraphEnv = "FREEDOM_GRAPH"
+)
+
+// controllerBinding is a controller bound to a route.
+type controllerBinding struct {
+	path       string
+	controller interface{}
+}
+
+// Graph Returns the resolved dependency graph of the controllers, services,
+// factories, repositories and infras in the format "json" or "dot".
+func (app *Application) Graph(format string) ([]byte, error) {
+	graph := app.buildDependencyGraph()
+	switch format {
+	case "json", "":
+		return json.MarshalIndent(graph, "", "  ")
+	case "dot":
+		return []byte(graph.dot()), nil
+	}
+	return nil, fmt.Errorf("unsupported graph format '%s', 'json' or 'dot' expected", format)
+}
+
+// dot returns the graph in the DOT language of Graphviz.
+func (graph *dependencyGraph) dot() string {
+	shapes := map[string]string{
+		kindController: "box",
+		kindService:    "ellipse",
+		kindFactory:    "hexagon",
+		kindRepository: "cylinder",
+		kindInfra:      "component",
+	}
+
+	var builder strings.Builder
+	builder.WriteString("digraph freedom {\n\trankdir=LR;\n")
+	for _, node := range graph.Nodes {
+		label := node.Kind + "\\n" + node.Type
+		style := "solid"
+		if node.Path != "" {
+			label += "\\n" + node.Path
+		}
+		if node.Single || node.Lifetime == Singleton.String() {
+			label += "\\n(single)"
+			style = "bold"
+		} else if node.Lifetime == Transient.String() {
+			label += "\\n(transient)"
+			style = "dashed"
+		}
+		fmt.Fprintf(&builder, "\t%q [shape=%s, style=%s, label=\"%s\"];\n", node.Type, shapes[node.Kind], style, label)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&builder, "\t%q -> %q [label=%q];\n", edge.From, edge.To, edge.Field)
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+// printGraph runs the prepared functions and prints the graph to stdout.
+// The logger is disabled so that only the graph is printed.
+func (app *Application) printGraph(format string) {
+	app.Logger().SetLevel("disable")
+	for index := 0; index < len(prepares); index++ {
+		prepares[index](app)
+	}
+	data, err := app.Graph(format)
+	if err != nil {
+		app.Logger().Fatalf("[Freedom] %v", err)
+	}
+	os.Stdout.Write(data)
+}
+
+// registerGraph registers the route of the dependency graph, the format is
+// selected by the query parameter 'format'.
+func (app *Application) registerGraph(conf IrisConfiguration) {
+	path, ok := conf.Other["graph_path"]
+	if !ok {
+		return
+	}
+	app.Iris().Get(fmt.Sprint(path), func(ctx IrisContext) {
+		format := ctx.URLParamDefault("format", "json")
+		data, err := app.Graph(format)
+		if err != nil {
+			ctx.StatusCode(400)
+			ctx.WriteString(err.Error())
+			return
+		}
+		if format == "dot" {
+			ctx.ContentType("text/vnd.graphviz")
+		} else {
+			ctx.ContentType("application/json")
+		}
+		ctx.Write(data)
+	})
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthUp The component is working.
+	HealthUp = "up"
+	// HealthDown The component is not working.
+	HealthDown = "down"
+	// HealthDraining The application is shutting down.
+	HealthDraining = "draining"
+
+	defaultHealthSecond = 3
+)
+
+// HealthChecker is implemented by the components that report their health.
+// The singleton infras, the installed databases, the redis client and the
+// custom data sources are checked by the readiness endpoint.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// HealthComponent The health status of a component.
+type HealthComponent struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// HealthReport The aggregated health status of the application.
+type HealthReport struct {
+	Status     string            `json:"status"`
+	Components []HealthComponent `json:"components"`
+}
+
+// healthCheck is a named check function of a component.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Health Checks all components and returns the aggregated report.
+// The report is down if any component is down.
+func (app *Application) Health(ctx context.Context) HealthReport {
+	checks := app.healthChecks()
+	report := HealthReport{Status: HealthUp, Components: make([]HealthComponent, len(checks))}
+
+	var wg sync.WaitGroup
+	for i := 0; i < len(checks); i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			report.Components[index] = runHealthCheck(ctx, checks[index])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, component := range report.Components {
+		if component.Status != HealthUp {
+			report.Status = HealthDown
+			break
+		}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, hc healthCheck) (result HealthComponent) {
+	result.Name = hc.name
+	result.Status = HealthUp
+	start := time.Now()
+	defer func() {
+		if perr := recover(); perr != nil {
+			result.Status = HealthDown
+			result.Error = fmt.Sprint(perr)
+		}
+		result.Latency = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	if err := hc.check(ctx); err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	return
+}
+
+// healthChecks collects the checks of the installed components.
+func (app *Application) healthChecks() (result []healthCheck) {
+	sources := append([]*dataSource{&app.Database.primary}, app.Database.sources...)
+	for _, source := range sources {
+		name := "db"
+		if source.name != "" {
+			name = "db:" + source.name
+		}
+		if check := dbHealthCheck(source.db); check != nil {
+			result = append(result, healthCheck{name: name, check: check})
+		}
+		for i, replica := range source.replicas {
+			if check := dbHealthCheck(replica); check != nil {
+				result = append(result, healthCheck{name: fmt.Sprintf("%s:replica:%d", name, i), check: check})
+			}
+		}
+	}
+
+	if app.Cache.client != nil {
+		client := app.Cache.client
+		result = append(result, healthCheck{name: "redis", check: func(ctx context.Context) error {
+			if checker, ok := client.(HealthChecker); ok {
+				return checker.HealthCheck(ctx)
+			}
+			return client.Ping(ctx).Err()
+		}})
+	}
+
+	for t, value := range app.other.pool {
+		if checker, ok := value.Interface().(HealthChecker); ok {
+			result = append(result, healthCheck{name: "custom:" + t.String(), check: checker.HealthCheck})
+		}
+	}
+
+	for t, com := range app.comPool.singlemap {
+		if checker, ok := com.(HealthChecker); ok {
+			result = append(result, healthCheck{name: "infra:" + t.String(), check: checker.HealthCheck})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return
+}
+
+// dbHealthCheck returns the check of the database handle, nil if it cannot be checked.
+// Support HealthChecker, *sql.DB and the handles like *gorm.DB that return *sql.DB.
+func dbHealthCheck(db interface{}) func(ctx context.Context) error {
+	if db == nil || (reflect.ValueOf(db).Kind() == reflect.Ptr && reflect.ValueOf(db).IsNil()) {
+		return nil
+	}
+	switch handle := db.(type) {
+	case HealthChecker:
+		return handle.HealthCheck
+	case interface {
+		PingContext(ctx context.Context) error
+	}:
+		return handle.PingContext
+	case interface{ DB() (*sql.DB, error) }:
+		return func(ctx context.Context) error {
+			sqlDB, err := handle.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}
+	}
+	return nil
+}
+
+// registerHealth registers the liveness and readiness endpoints.
+// The endpoints are registered before the middlewares and do not create a worker.
+func (app *Application) registerHealth(conf IrisConfiguration) {
+	if path, ok := conf.Other["liveness_path"]; ok {
+		app.Iris().Get(fmt.Sprint(path), func(ctx IrisContext) {
+			ctx.JSON(HealthReport{Status: HealthUp, Components: []HealthComponent{}})
+		})
+	}
+
+	path, ok := conf.Other["readiness_path"]
+	if !ok {
+		return
+	}
+	timeout := time.Duration(configInt(conf, "readiness_timeout_second", defaultHealthSecond)) * time.Second
+	app.Iris().Get(fmt.Sprint(path), func(ctx IrisContext) {
+		if app.Draining() {
+			ctx.StatusCode(http.StatusServiceUnavailable)
+			ctx.JSON(HealthReport{Status: HealthDraining, Components: []HealthComponent{}})
+			return
+		}
+
+		stdCtx, cancel := context.WithTimeout(ctx.Request().Context(), timeout)
+		defer cancel()
+
+		report := app.Health(stdCtx)
+		if report.Status != HealthUp {
+			ctx.StatusCode(http.StatusServiceUnavailable)
+		}
+		ctx.JSON(report)
+	})
+}
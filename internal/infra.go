@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
 
@@ -27,14 +26,12 @@ func (infra *Infra) BeginRequest(rt Worker) {
 
 // FetchOnlyDB Gets the installed database handle.
 func (infra *Infra) FetchOnlyDB(db interface{}) error {
-	resultDB := globalApp.Database.db
-	if resultDB == nil {
-		return errors.New("DB not found, please install")
-	}
-	if !fetchValue(db, resultDB) {
-		return errors.New("DB not found, please install")
-	}
-	return nil
+	return fetchDB(nil, "", db)
+}
+
+// FetchOnlyNamedDB Gets the database handle installed under name.
+func (infra *Infra) FetchOnlyNamedDB(name string, db interface{}) error {
+	return fetchDB(nil, name, db)
 }
 
 // Redis Gets the installed redis client.
@@ -58,8 +55,7 @@ func (infra *Infra) NewHTTPRequest(url string, transferBus ...bool) requests.Req
 		//The singleton object does not have a Worker component
 		return req
 	}
-	req.SetHeader(infra.worker.Bus().Header)
-	return req
+	return transferWorker(infra.worker, req)
 }
 
 // NewH2CRequest transferBus : Whether to pass the context, turned on by default. Typically used for tracking internal services.
@@ -72,8 +68,7 @@ func (infra *Infra) NewH2CRequest(url string, transferBus ...bool) requests.Requ
 		//The singleton object does not have a Worker component
 		return req
 	}
-	req.SetHeader(infra.worker.Bus().Header)
-	return req
+	return transferWorker(infra.worker, req)
 }
 
 // InjectBaseEntity The base class object that is injected into the entity.
@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/8treenet/iris/v12/context"
@@ -12,14 +13,15 @@ func newInfraPool() *infraPool {
 	result := new(infraPool)
 	result.singlemap = make(map[reflect.Type]interface{})
 	result.instancePool = make(map[reflect.Type]*sync.Pool)
+	result.instanceCreater = make(map[reflect.Type]interface{})
 	return result
 }
 
 // infraPool .
 type infraPool struct {
-	instancePool map[reflect.Type]*sync.Pool
-	singlemap    map[reflect.Type]interface{}
-	shutdownList []func()
+	instancePool    map[reflect.Type]*sync.Pool
+	instanceCreater map[reflect.Type]interface{}
+	singlemap       map[reflect.Type]interface{}
 }
 
 // bind .
@@ -34,6 +36,7 @@ func (pool *infraPool) bind(single bool, t reflect.Type, com interface{}) {
 		}
 		return
 	}
+	pool.instanceCreater[t] = com
 	pool.instancePool[t] = &sync.Pool{
 		New: func() interface{} {
 
@@ -94,12 +97,16 @@ func (pool *infraPool) getByInternal(ptr reflect.Value) bool {
 	return false
 }
 
-// singleBooting .
+// singleBooting boots the singletons after the singletons they depend on.
 func (pool *infraPool) singleBooting(app *Application) {
 	type boot interface {
 		Booting(BootManager)
 	}
-	for _, com := range pool.singlemap {
+	singles, cycle := pool.singleOrdered()
+	if len(cycle) > 0 {
+		globalApp.Logger().Errorf("[Freedom] Booting: The singletons have a circular dependency, %v", cycle)
+	}
+	for _, com := range singles {
 		bootimpl, ok := com.(boot)
 		if !ok {
 			continue
@@ -108,15 +115,41 @@ func (pool *infraPool) singleBooting(app *Application) {
 	}
 }
 
-func (pool *infraPool) registerShutdown(f func()) {
-	pool.shutdownList = append(pool.shutdownList, f)
-}
+// singleOrdered returns the singletons in the order of their dependencies.
+// A singleton depends on the singletons referenced by its fields, the others
+// are ordered by the type name. The types in a circular dependency are returned
+// as cycle.
+func (pool *infraPool) singleOrdered() (result []interface{}, cycle []string) {
+	types := make([]reflect.Type, 0, len(pool.singlemap))
+	for t := range pool.singlemap {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+
+	coms := make([]interface{}, len(types))
+	index := make(map[interface{}]int, len(types))
+	for i, t := range types {
+		coms[i] = pool.singlemap[t]
+		index[coms[i]] = i
+	}
 
-// shutdown .
-func (pool *infraPool) shutdown() {
-	for i := 0; i < len(pool.shutdownList); i++ {
-		pool.shutdownList[i]()
+	order, cycleIndex := sortByDependency(len(coms), func(i int) (deps []int) {
+		allFields(coms[i], func(value reflect.Value) {
+			if dep := pool.single(value.Type()); dep != nil {
+				deps = append(deps, index[dep])
+			}
+		})
+		return
+	})
+	for _, i := range cycleIndex {
+		cycle = append(cycle, types[i].String())
+	}
+	for _, i := range order {
+		result = append(result, coms[i])
 	}
+	return
 }
 
 func (pool *infraPool) single(t reflect.Type) interface{} {
@@ -0,0 +1,50 @@
+package internal
+
+// FencingTokenKey The key of the fencing token in Worker.Store() for the jobs
+// that run on the leader only.
+const FencingTokenKey = "freedom_fencing_token"
+
+// LeaderElector Elects one instance of the service as the leader, see infra/election.
+// The jobs and the hooks that are leader only run on the leader.
+type LeaderElector interface {
+	// IsLeader Reports whether this instance holds the lease.
+	IsLeader() bool
+	// FencingToken Returns the token of the lease held by this instance, it
+	// increases with every new lease. Pass it to the storage to reject the
+	// writes of a stale leader. It returns false if this instance is not the leader.
+	FencingToken() (int64, bool)
+	// Watch Calls f when this instance becomes the leader or loses the leadership.
+	Watch(f func(leader bool))
+}
+
+// InstallLeaderElector Installs the leader elector.
+// Without a leader elector every instance is the leader.
+func (app *Application) InstallLeaderElector(elector LeaderElector) {
+	app.leaderElector = elector
+	app.lifecycle.electLeader(elector != nil)
+	if elector == nil {
+		return
+	}
+	//The hooks run off the goroutine of the elector, they do not delay the renewal of the lease
+	elector.Watch(func(leader bool) {
+		app.lifecycle.changeLeader(leader, func(err error) {
+			app.Logger().Errorf("[Freedom] An error was encountered while the leadership changed, %v", err)
+		})
+	})
+}
+
+// IsLeader Reports whether this instance runs the leader only work.
+func (app *Application) IsLeader() bool {
+	if app.leaderElector == nil {
+		return true
+	}
+	return app.leaderElector.IsLeader()
+}
+
+// fencingToken returns the fencing token of the leader, zero without a leader elector.
+func (app *Application) fencingToken() (int64, bool) {
+	if app.leaderElector == nil {
+		return 0, true
+	}
+	return app.leaderElector.FencingToken()
+}
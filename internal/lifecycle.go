@@ -0,0 +1,362 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LifecyclePhase The phase of the application in which a hook runs.
+type LifecyclePhase int
+
+const (
+	// OnStart Runs after the singletons are booted and before the server listens.
+	OnStart LifecyclePhase = iota
+	// OnReady Runs once the server is listening.
+	OnReady
+	// OnDrain Runs first when the application shuts down, while the server still
+	// handles the in-flight requests. Stop consuming and producing work here.
+	OnDrain
+	// OnStop Runs after the server has stopped. Close the connections here.
+	OnStop
+)
+
+// String .
+func (phase LifecyclePhase) String() string {
+	switch phase {
+	case OnStart:
+		return "OnStart"
+	case OnReady:
+		return "OnReady"
+	case OnDrain:
+		return "OnDrain"
+	case OnStop:
+		return "OnStop"
+	}
+	return fmt.Sprintf("LifecyclePhase(%d)", int(phase))
+}
+
+// reverse reports whether the hooks of the phase run in the reverse order.
+func (phase LifecyclePhase) reverse() bool {
+	return phase == OnDrain || phase == OnStop
+}
+
+// LifecycleHook A function that runs in a phase of the application.
+// The hooks of OnStart and OnReady run in the order of registration, a hook
+// runs after the hooks named by DependsOn. The hooks of OnDrain and OnStop run
+// in the reverse order, a hook runs before the hooks it depends on.
+// Singletons are booted in the order of their dependencies, so the hooks they
+// register are ordered by the dependencies too.
+type LifecycleHook struct {
+	// Name of the hook, used by DependsOn and in the errors.
+	Name string
+	// Phase in which the hook runs.
+	Phase LifecyclePhase
+	// Names of the hooks of the same phase that this hook depends on.
+	DependsOn []string
+	// Timeout of the hook, zero means the deadline of the phase.
+	Timeout time.Duration
+	// Func is called with a context that expires at the timeout.
+	Func func(ctx context.Context) error
+	// LeaderOnly runs the hook while this instance is the leader, see InstallLeaderElector.
+	// The OnStart and OnReady hooks run after the other hooks of the phase, or
+	// when this instance becomes the leader later, then their context is also
+	// canceled when the leadership is lost. The OnDrain and OnStop hooks
+	// run before the other hooks of the phase, or when this instance loses the
+	// leadership, so they stop the work started by the leader.
+	LeaderOnly bool
+}
+
+// lifecycle holds the registered hooks.
+type lifecycle struct {
+	mu    sync.Mutex
+	hooks []LifecycleHook
+
+	// leaderMu serializes the leader only hooks.
+	leaderMu sync.Mutex
+	// leading reports whether the leader only hooks of the reached phases have run.
+	leading bool
+	// reached are the OnStart and OnReady phases that have run.
+	reached []LifecyclePhase
+	// stopping is set when the OnDrain phase begins, the leadership no longer changes the hooks.
+	stopping bool
+
+	// ctxMu guards leaderCtx, it is canceled as soon as the leadership is lost.
+	ctxMu        sync.Mutex
+	leaderCtx    context.Context
+	leaderCancel context.CancelFunc
+
+	// changes are the leadership changes that wait for setLeader, changing is
+	// set while a goroutine applies them.
+	changesMu sync.Mutex
+	changes   []bool
+	changing  bool
+}
+
+// newLifecycle returns a lifecycle without a leader elector, the instance is the leader.
+func newLifecycle() *lifecycle {
+	return &lifecycle{leading: true, leaderCtx: context.Background(), leaderCancel: func() {}}
+}
+
+// electLeader waits for setLeader before the leader only hooks run if elected,
+// otherwise the instance is the leader.
+func (l *lifecycle) electLeader(elected bool) {
+	l.leaderMu.Lock()
+	defer l.leaderMu.Unlock()
+	l.leading = !elected
+	l.ctxMu.Lock()
+	defer l.ctxMu.Unlock()
+	l.leaderCtx, l.leaderCancel = context.WithCancel(context.Background())
+	if elected {
+		l.leaderCancel()
+	}
+}
+
+// leadership returns a context that is canceled when this instance loses the leadership.
+func (l *lifecycle) leadership() context.Context {
+	l.ctxMu.Lock()
+	defer l.ctxMu.Unlock()
+	return l.leaderCtx
+}
+
+// changeLeader applies a change of the leadership in another goroutine, the
+// elector is not blocked by the hooks. The changes are applied in order, the
+// leadership context is canceled at once when the leadership is lost.
+func (l *lifecycle) changeLeader(leader bool, report func(error)) {
+	if !leader {
+		l.ctxMu.Lock()
+		l.leaderCancel()
+		l.ctxMu.Unlock()
+	}
+
+	l.changesMu.Lock()
+	l.changes = append(l.changes, leader)
+	if l.changing {
+		l.changesMu.Unlock()
+		return
+	}
+	l.changing = true
+	l.changesMu.Unlock()
+
+	go func() {
+		for {
+			l.changesMu.Lock()
+			if len(l.changes) == 0 {
+				l.changing = false
+				l.changesMu.Unlock()
+				return
+			}
+			leader := l.changes[0]
+			l.changes = l.changes[1:]
+			l.changesMu.Unlock()
+
+			if err := l.setLeader(leader); err != nil {
+				report(err)
+			}
+		}
+	}()
+}
+
+// setLeader runs the leader only hooks of the reached phases when this instance
+// becomes the leader, with the leadership context, and the leader only OnDrain
+// and OnStop hooks when it loses the leadership.
+func (l *lifecycle) setLeader(leader bool) error {
+	l.leaderMu.Lock()
+	defer l.leaderMu.Unlock()
+	if l.stopping || l.leading == leader {
+		return nil
+	}
+	l.leading = leader
+
+	var errs []error
+	if leader {
+		l.ctxMu.Lock()
+		l.leaderCtx, l.leaderCancel = context.WithCancel(context.Background())
+		ctx := l.leaderCtx
+		l.ctxMu.Unlock()
+		for _, phase := range l.reached {
+			errs = append(errs, l.runHooks(ctx, phase, true))
+		}
+		return errors.Join(errs...)
+	}
+
+	l.ctxMu.Lock()
+	l.leaderCancel()
+	l.ctxMu.Unlock()
+	if len(l.reached) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	for _, phase := range []LifecyclePhase{OnDrain, OnStop} {
+		errs = append(errs, l.runHooks(ctx, phase, true))
+	}
+	return errors.Join(errs...)
+}
+
+func (l *lifecycle) register(hook LifecycleHook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if hook.Name == "" {
+		hook.Name = fmt.Sprintf("%s-%d", hook.Phase, len(l.hooks))
+	}
+	l.hooks = append(l.hooks, hook)
+}
+
+// ordered returns the hooks of the phase in the order they run.
+func (l *lifecycle) ordered(phase LifecyclePhase) ([]LifecycleHook, error) {
+	l.mu.Lock()
+	var hooks []LifecycleHook
+	for _, hook := range l.hooks {
+		if hook.Phase == phase {
+			hooks = append(hooks, hook)
+		}
+	}
+	l.mu.Unlock()
+
+	index := make(map[string]int, len(hooks))
+	for i, hook := range hooks {
+		index[hook.Name] = i
+	}
+	order, cycle := sortByDependency(len(hooks), func(i int) (deps []int) {
+		for _, name := range hooks[i].DependsOn {
+			if j, ok := index[name]; ok {
+				deps = append(deps, j)
+			}
+		}
+		return
+	})
+	var err error
+	if len(cycle) > 0 {
+		names := make([]string, 0, len(cycle))
+		for _, i := range cycle {
+			names = append(names, hooks[i].Name)
+		}
+		err = fmt.Errorf("%s hooks have a circular dependency: %v", phase, names)
+	}
+
+	result := make([]LifecycleHook, 0, len(hooks))
+	for _, i := range order {
+		result = append(result, hooks[i])
+	}
+	if phase.reverse() {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return result, err
+}
+
+// run runs the hooks of the phase one by one, the errors are collected and returned.
+func (l *lifecycle) run(ctx context.Context, phase LifecyclePhase) error {
+	if phase.reverse() {
+		l.leaderMu.Lock()
+		l.stopping = true
+		leading := l.leading
+		l.leaderMu.Unlock()
+		if !leading {
+			return l.runHooks(ctx, phase, false)
+		}
+		return errors.Join(l.runHooks(ctx, phase, true), l.runHooks(ctx, phase, false))
+	}
+
+	err := l.runHooks(ctx, phase, false)
+	l.leaderMu.Lock()
+	defer l.leaderMu.Unlock()
+	l.reached = append(l.reached, phase)
+	if !l.leading {
+		return err
+	}
+	return errors.Join(err, l.runHooks(ctx, phase, true))
+}
+
+// runHooks runs the leader only hooks of the phase or the others.
+func (l *lifecycle) runHooks(ctx context.Context, phase LifecyclePhase, leaderOnly bool) error {
+	hooks, err := l.ordered(phase)
+	var errs []error
+	if !leaderOnly {
+		errs = append(errs, err)
+	}
+	for _, hook := range hooks {
+		if hook.LeaderOnly != leaderOnly {
+			continue
+		}
+		if err := runHook(ctx, hook); err != nil {
+			errs = append(errs, fmt.Errorf("%s hook '%s': %w", phase, hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runHook calls the hook and returns when it finished or timed out.
+func runHook(ctx context.Context, hook LifecycleHook) error {
+	if hook.Func == nil {
+		return nil
+	}
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if perr := recover(); perr != nil {
+				result <- fmt.Errorf("panic: %v", perr)
+			}
+		}()
+		result <- hook.Func(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sortByDependency sorts 0..n-1 so that every element comes after its dependencies.
+// Independent elements keep their original order. The elements that are left in
+// a cycle are appended in their original order and returned as cycle too.
+func sortByDependency(n int, deps func(i int) []int) (result []int, cycle []int) {
+	dependents := make([][]int, n)
+	pending := make([]int, n)
+	for i := 0; i < n; i++ {
+		for _, dep := range deps(i) {
+			if dep == i {
+				continue
+			}
+			dependents[dep] = append(dependents[dep], i)
+			pending[i]++
+		}
+	}
+
+	done := make([]bool, n)
+	for len(result) < n {
+		next := -1
+		for i := 0; i < n; i++ {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			for i := 0; i < n; i++ {
+				if !done[i] {
+					cycle = append(cycle, i)
+				}
+			}
+			return append(result, cycle...), cycle
+		}
+
+		done[next] = true
+		result = append(result, next)
+		for _, dependent := range dependents[next] {
+			pending[dependent]--
+		}
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Lifetime The lifetime of the objects created by the functions bound with
+// BindService, BindRepository and BindFactory.
+type Lifetime int
+
+const (
+	// PerRequest The object is pooled and used by one request at a time, it is the default.
+	PerRequest Lifetime = iota
+	// Singleton One object is created and shared by all the requests. It must
+	// not have a Worker field and its dependencies must be singletons too.
+	Singleton
+	// Transient A new object is created for every request and it is never reused.
+	Transient
+)
+
+// String .
+func (lifetime Lifetime) String() string {
+	switch lifetime {
+	case PerRequest:
+		return "per-request"
+	case Singleton:
+		return "singleton"
+	case Transient:
+		return "transient"
+	}
+	return fmt.Sprintf("Lifetime(%d)", int(lifetime))
+}
+
+// parseLifetime returns the optional lifetime, PerRequest by default.
+func parseLifetime(lifetime []Lifetime) Lifetime {
+	if len(lifetime) == 0 {
+		return PerRequest
+	}
+	return lifetime[0]
+}
+
+// singletons creates each singleton object once.
+type singletons struct {
+	mu      sync.Mutex
+	objects map[reflect.Type]reflect.Value
+}
+
+func (s *singletons) get(t reflect.Type, create func() (reflect.Value, error)) (reflect.Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if obj, ok := s.objects[t]; ok {
+		return obj, nil
+	}
+	obj, err := create()
+	if err != nil {
+		return obj, err
+	}
+	if s.objects == nil {
+		s.objects = make(map[reflect.Type]reflect.Value)
+	}
+	s.objects[t] = obj
+	return obj, nil
+}
+
+// lifetimeOfValue returns the lifetime of the repository or the factory in value.
+// The other objects are per-request.
+func (app *Application) lifetimeOfValue(value reflect.Value) Lifetime {
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return PerRequest
+		}
+		value = value.Elem()
+	}
+	if lifetime, ok := app.rpool.lifetimes[value.Type()]; ok {
+		return lifetime
+	}
+	return app.factoryPool.lifetimes[value.Type()]
+}
+
+// lifetimeOf returns the lifetime of the bound type of the kind.
+func (app *Application) lifetimeOf(kind string, t reflect.Type) Lifetime {
+	switch kind {
+	case kindService:
+		return app.pool.lifetimes[t]
+	case kindRepository:
+		return app.rpool.lifetimes[t]
+	case kindFactory:
+		return app.factoryPool.lifetimes[t]
+	case kindInfra:
+		if _, ok := app.comPool.singlemap[t]; ok {
+			return Singleton
+		}
+	}
+	return PerRequest
+}
+
+// diSingleton injects the dependencies of a singleton object. The dependencies
+// must be singletons and the object must not have a Worker field.
+func (app *Application) diSingleton(obj reflect.Value, resolvers ...string) (e error) {
+	resolvers = append([]string{kindWorker}, resolvers...)
+	injectFields(obj, func(field reflect.StructField, value reflect.Value) {
+		if e != nil || field.Tag.Get(dependencyTag) == "-" || !value.IsNil() {
+			return
+		}
+		kind, target := app.resolveField(value.Type(), resolvers)
+		if kind == "" {
+			return
+		}
+		if kind == kindWorker {
+			e = fmt.Errorf("the singleton %v must not have the Worker field %s", obj.Type(), field.Name)
+			return
+		}
+		if app.lifetimeOf(kind, target) != Singleton {
+			e = fmt.Errorf("the singleton %v must not capture the %s %s %v", obj.Type(), app.lifetimeOf(kind, target), kind, target)
+			return
+		}
+		if !value.CanSet() {
+			e = fmt.Errorf("the field %v.%s must be exported to be injected", obj.Type(), field.Name)
+			return
+		}
+
+		switch kind {
+		case kindRepository:
+			repo, err := app.rpool.singleton(target)
+			if err != nil {
+				e = err
+				return
+			}
+			value.Set(repo)
+		case kindFactory:
+			factory, err := app.factoryPool.singleton(target)
+			if err != nil {
+				e = err
+				return
+			}
+			value.Set(factory)
+		case kindInfra:
+			value.Set(reflect.ValueOf(app.comPool.single(value.Type())))
+		}
+	})
+	return
+}
+
+// newSingleton creates a singleton object with the bound function.
+func newSingleton(creater interface{}, resolvers ...string) (reflect.Value, error) {
+	obj, err := callCreater(creater)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	value := reflect.ValueOf(obj)
+	if err := globalApp.diSingleton(value, resolvers...); err != nil {
+		return value, err
+	}
+
+	type setSingle interface {
+		setSingle()
+	}
+	if call, ok := obj.(setSingle); ok {
+		call.setSingle()
+	}
+	return value, nil
+}
@@ -27,6 +27,12 @@ const (
 
 	kafkaProducerReqsName    = "kafka_producer_requests_total"
 	kafkaProducerLatencyName = "kafka_producer_duration_seconds"
+
+	jobReqsName    = "job_runs_total"
+	jobLatencyName = "job_duration_seconds"
+
+	queueReqsName    = "queue_jobs_total"
+	queueLatencyName = "queue_job_duration_seconds"
 )
 
 // Prometheus is a handler that exposes prometheus metrics for the number of requests,
@@ -38,10 +44,14 @@ type Prometheus struct {
 	latency *prometheus.HistogramVec
 	listen  string
 
-	ormReqs    *prometheus.CounterVec
-	ormLatency *prometheus.HistogramVec
-	counters   []*prometheus.CounterVec
-	histograms []*prometheus.HistogramVec
+	ormReqs      *prometheus.CounterVec
+	ormLatency   *prometheus.HistogramVec
+	jobReqs      *prometheus.CounterVec
+	jobLatency   *prometheus.HistogramVec
+	queueReqs    *prometheus.CounterVec
+	queueLatency *prometheus.HistogramVec
+	counters     []*prometheus.CounterVec
+	histograms   []*prometheus.HistogramVec
 }
 
 type log interface {
@@ -94,6 +104,44 @@ func registerPrometheus(p *Prometheus, name, listen string) {
 	)
 	prometheus.MustRegister(p.ormLatency)
 
+	p.jobReqs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        jobReqsName,
+			Help:        "How many times the scheduled jobs ran, partitioned by job and result.",
+			ConstLabels: prometheus.Labels{"service": name},
+		},
+		[]string{"job", "result"},
+	)
+	prometheus.MustRegister(p.jobReqs)
+
+	p.jobLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        jobLatencyName,
+		Help:        "How long the scheduled jobs ran, partitioned by job and result.",
+		ConstLabels: prometheus.Labels{"service": name},
+	},
+		[]string{"job", "result"},
+	)
+	prometheus.MustRegister(p.jobLatency)
+
+	p.queueReqs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        queueReqsName,
+			Help:        "How many queue jobs processed, partitioned by queue, type and result.",
+			ConstLabels: prometheus.Labels{"service": name},
+		},
+		[]string{"queue", "type", "result"},
+	)
+	prometheus.MustRegister(p.queueReqs)
+
+	p.queueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        queueLatencyName,
+		Help:        "How long the queue jobs ran, partitioned by queue, type and result.",
+		ConstLabels: prometheus.Labels{"service": name},
+	},
+		[]string{"queue", "type", "result"},
+	)
+	prometheus.MustRegister(p.queueLatency)
+
 	for i := 0; i < len(p.counters); i++ {
 		prometheus.MustRegister(p.counters[i])
 	}
@@ -147,6 +195,30 @@ func (p *Prometheus) OrmWithLabelValues(model, method string, e error, starTime
 	p.ormLatency.WithLabelValues(model, method, result).Observe(float64(time.Since(starTime).Nanoseconds()) / 1000000000)
 }
 
+// JobWithLabelValues .
+func (p *Prometheus) JobWithLabelValues(job, result string, starTime time.Time) {
+	if p.listen == "" {
+		return
+	}
+
+	p.jobReqs.WithLabelValues(job, result).Inc()
+	if result != jobSkipped && result != jobFollower {
+		p.jobLatency.WithLabelValues(job, result).Observe(float64(time.Since(starTime).Nanoseconds()) / 1000000000)
+	}
+}
+
+// QueueWithLabelValues .
+func (p *Prometheus) QueueWithLabelValues(queue, jobType, result string, starTime time.Time) {
+	if p.listen == "" {
+		return
+	}
+
+	p.queueReqs.WithLabelValues(queue, jobType, result).Inc()
+	if !starTime.IsZero() {
+		p.queueLatency.WithLabelValues(queue, jobType, result).Observe(float64(time.Since(starTime).Nanoseconds()) / 1000000000)
+	}
+}
+
 // func (p *Prometheus) HttpClientWithLabelValues(domain, httpCode, protocol, method string, starTime time.Time) {
 // 	p.httpClientReqs.WithLabelValues(domain, httpCode, protocol, method).Inc()
 // 	p.httpClientLatency.WithLabelValues(domain, httpCode, protocol, method).Observe(float64(time.Since(starTime).Nanoseconds()) / 1000000000)
@@ -8,12 +8,15 @@ import (
 func newRepoPool() *repositoryPool {
 	result := new(repositoryPool)
 	result.creater = make(map[reflect.Type]interface{})
+	result.lifetimes = make(map[reflect.Type]Lifetime)
 	return result
 }
 
 // repositoryPool .
 type repositoryPool struct {
-	creater map[reflect.Type]interface{}
+	creater    map[reflect.Type]interface{}
+	lifetimes  map[reflect.Type]Lifetime
+	singletons singletons
 }
 
 // get .
@@ -31,8 +34,16 @@ func (pool *repositoryPool) get(t reflect.Type) (ok bool, result reflect.Value)
 	return true, values[0]
 }
 
-func (pool *repositoryPool) bind(outType reflect.Type, f interface{}) {
+func (pool *repositoryPool) bind(outType reflect.Type, f interface{}, lifetime Lifetime) {
 	pool.creater[outType] = f
+	pool.lifetimes[outType] = lifetime
+}
+
+// singleton returns the singleton repository of type t.
+func (pool *repositoryPool) singleton(t reflect.Type) (reflect.Value, error) {
+	return pool.singletons.get(t, func() (reflect.Value, error) {
+		return newSingleton(pool.creater[t], kindInfra)
+	})
 }
 
 func (pool *repositoryPool) allType() (list []reflect.Type) {
@@ -51,25 +62,10 @@ func (pool *repositoryPool) diRepo(repo interface{}, instance *serviceElement) {
 func (pool *repositoryPool) diRepoFromValue(value reflect.Value, instance *serviceElement) bool {
 	//如果是指针的成员变量
 	if value.Kind() == reflect.Ptr && value.IsZero() {
-		ok, newfield := pool.get(value.Type())
-		if !ok {
+		if _, ok := pool.creater[value.Type()]; !ok {
 			return false
 		}
-		if !value.CanSet() {
-			panic(fmt.Sprintf("[Freedom] This use repository object must be a capital variable: %v", value.Type().String()))
-		}
-		//创建实例并且注入基础设施组件
-		value.Set(newfield)
-		allFieldsFromValue(newfield, func(repoValue reflect.Value) {
-			globalApp.comPool.diInfraFromValue(repoValue)
-			if repoValue.IsNil() {
-				return
-			}
-			if br, ok := repoValue.Interface().(BeginRequest); ok {
-				instance.calls = append(instance.calls, br)
-			}
-		})
-		//globalApp.comPool.diInfra(newfield.Interface())
+		pool.inject(value, value.Type(), instance)
 		return true
 	}
 
@@ -80,27 +76,54 @@ func (pool *repositoryPool) diRepoFromValue(value reflect.Value, instance *servi
 			if !typeList[index].Implements(value.Type()) {
 				continue
 			}
-			ok, newfield := pool.get(typeList[index])
-			if !ok {
-				continue
-			}
-			if !value.CanSet() {
-				panic(fmt.Sprintf("[Freedom] This use repository object must be a capital variable: %v", value.Type().String()))
-			}
-			//创建实例并且注入基础设施组件
-			value.Set(newfield)
-			allFieldsFromValue(newfield, func(repoValue reflect.Value) {
-				globalApp.comPool.diInfraFromValue(repoValue)
-				if repoValue.IsNil() {
-					return
-				}
-				if br, ok := repoValue.Interface().(BeginRequest); ok {
-					instance.calls = append(instance.calls, br)
-				}
-			})
-			//globalApp.comPool.diInfra(newfield.Interface())
+			pool.inject(value, typeList[index], instance)
 			return true
 		}
 	}
 	return false
 }
+
+// inject sets value with the repository of type t according to its lifetime.
+func (pool *repositoryPool) inject(value reflect.Value, t reflect.Type, instance *serviceElement) {
+	if !value.CanSet() {
+		panic(fmt.Sprintf("[Freedom] This use repository object must be a capital variable: %v", value.Type().String()))
+	}
+
+	switch pool.lifetimes[t] {
+	case Singleton:
+		repo, err := pool.singleton(t)
+		if err != nil {
+			panic(fmt.Sprintf("[Freedom] BindRepository: %v", err))
+		}
+		value.Set(repo)
+	case Transient:
+		pool.create(value, t, &serviceElement{})
+		//每个请求重新创建
+		instance.transients = append(instance.transients, func(rt Worker) {
+			transient := serviceElement{}
+			pool.create(value, t, &transient)
+			if br, ok := value.Interface().(BeginRequest); ok {
+				transient.calls = append(transient.calls, br)
+			}
+			globalApp.pool.beginRequest(rt, transient)
+		})
+	default:
+		pool.create(value, t, instance)
+	}
+}
+
+// create sets value with a new repository of type t.
+func (pool *repositoryPool) create(value reflect.Value, t reflect.Type, instance *serviceElement) {
+	_, newfield := pool.get(t)
+	//创建实例并且注入基础设施组件
+	value.Set(newfield)
+	allFieldsFromValue(newfield, func(repoValue reflect.Value) {
+		globalApp.comPool.diInfraFromValue(repoValue)
+		if repoValue.IsNil() {
+			return
+		}
+		if br, ok := repoValue.Interface().(BeginRequest); ok {
+			instance.calls = append(instance.calls, br)
+		}
+	})
+}
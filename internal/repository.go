@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -21,44 +20,56 @@ const (
 // The parent class of the repository, which can be inherited using the parent class's methods.
 type Repository struct {
 	worker Worker
+	single bool
 }
 
 // BeginRequest Polymorphic method, subclasses can override overrides overrides.
 // The request is triggered after entry.
+// A singleton repository does not have a Worker.
 func (repo *Repository) BeginRequest(rt Worker) {
+	if repo.single {
+		return
+	}
 	repo.worker = rt
 }
 
+func (repo *Repository) setSingle() {
+	repo.single = true
+}
+
 // FetchDB Gets the installed database handle.
 // DB can be changed through AOP, such as transaction processing.
+// With replicas, the reads of a *gorm.DB go to the replicas until the request writes.
 func (repo *Repository) FetchDB(db interface{}) error {
-	resultDB := globalApp.Database.db
+	return fetchDB(repo.worker, "", db)
+}
 
-	transactionData := repo.worker.Store().Get(TransactionKey)
-	if transactionData != nil {
-		resultDB = transactionData
-	}
-	if resultDB == nil {
-		return errors.New("DB not found, please install")
-	}
-	if !fetchValue(db, resultDB) {
-		return errors.New("DB not found, please install")
-	}
-	// db = globalApp.Database.db.New()
-	// db.SetLogger(repo.Worker.Logger())
-	return nil
+// FetchReadDB Gets a read replica of the installed database.
+// Inside a transaction, or after the request has written, the primary
+// is returned so that the request can read its own writes.
+func (repo *Repository) FetchReadDB(db interface{}) error {
+	return fetchReadDB(repo.worker, "", db)
+}
+
+// FetchNamedDB Gets the database handle installed under name.
+// Only the transaction opened on the same data source takes effect.
+func (repo *Repository) FetchNamedDB(name string, db interface{}) error {
+	return fetchDB(repo.worker, name, db)
+}
+
+// FetchReadNamedDB Gets a read replica of the database installed under name.
+func (repo *Repository) FetchReadNamedDB(name string, db interface{}) error {
+	return fetchReadDB(repo.worker, name, db)
 }
 
 // FetchOnlyDB Gets the installed database handle.
 func (repo *Repository) FetchOnlyDB(db interface{}) error {
-	resultDB := globalApp.Database.db
-	if resultDB == nil {
-		return errors.New("DB not found, please install")
-	}
-	if !fetchValue(db, resultDB) {
-		return errors.New("DB not found, please install")
-	}
-	return nil
+	return fetchDB(nil, "", db)
+}
+
+// FetchOnlyNamedDB Gets the database handle installed under name, ignoring transactions.
+func (repo *Repository) FetchOnlyNamedDB(name string, db interface{}) error {
+	return fetchDB(nil, name, db)
 }
 
 // Redis Gets the installed redis client.
@@ -72,8 +83,11 @@ func (repo *Repository) NewHTTPRequest(url string, transferBus ...bool) requests
 	if len(transferBus) > 0 && !transferBus[0] {
 		return req
 	}
-	req.SetHeader(repo.worker.Bus().Header)
-	return req
+	if repo.worker == nil {
+		//The singleton object does not have a Worker component
+		return req
+	}
+	return transferWorker(repo.worker, req)
 }
 
 // NewH2CRequest transferBus : Whether to pass the context, turned on by default. Typically used for tracking internal services.
@@ -82,8 +96,11 @@ func (repo *Repository) NewH2CRequest(url string, transferBus ...bool) requests.
 	if len(transferBus) > 0 && !transferBus[0] {
 		return req
 	}
-	req.SetHeader(repo.worker.Bus().Header)
-	return req
+	if repo.worker == nil {
+		//The singleton object does not have a Worker component
+		return req
+	}
+	return transferWorker(repo.worker, req)
 }
 
 // // SingleFlight .
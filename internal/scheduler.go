@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// The results of the job runs in the metrics.
+const (
+	jobOK      = "ok"
+	jobError   = "error"
+	jobPanic   = "panic"
+	jobTimeout = "timeout"
+	jobSkipped = "skipped"
+	// jobFollower is a leader only run skipped by a follower.
+	jobFollower = "follower"
+)
+
+// JobConfig The options of a job bound by BindJob.
+type JobConfig struct {
+	// Name of the job in the logs and the metrics, the name of the function by default.
+	Name string
+	// Timeout of a run, Worker.Context() expires at the timeout. Zero means no timeout.
+	Timeout time.Duration
+	// Jitter delays every run by a random duration in [0, Jitter), so that the
+	// instances of the service do not run the job at the same moment.
+	Jitter time.Duration
+	// AllowOverlap runs the job even if the previous run has not finished.
+	// By default the run is skipped.
+	AllowOverlap bool
+	// LeaderOnly runs the job only on the leader, see InstallLeaderElector.
+	// The fencing token of the leader is in Worker.Store() under FencingTokenKey,
+	// the context of a running job is canceled when the leadership is lost.
+	LeaderOnly bool
+}
+
+// job is a function bound by BindJob.
+type job struct {
+	name     string
+	spec     string
+	schedule schedule
+	fun      interface{}
+	conf     JobConfig
+	running  int32
+}
+
+// scheduler runs the jobs with the service locator, from OnReady to OnDrain.
+type scheduler struct {
+	jobs   []*job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newScheduler() *scheduler {
+	return new(scheduler)
+}
+
+func (s *scheduler) bind(spec string, fun interface{}, conf ...*JobConfig) error {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := parseCallServiceFunc(fun); err != nil {
+		return err
+	}
+	if reflect.TypeOf(fun).NumOut() != 1 || reflect.TypeOf(fun).Out(0) != errorType {
+		return fmt.Errorf("the job must return an error")
+	}
+
+	j := &job{spec: spec, schedule: sched, fun: fun}
+	if len(conf) > 0 && conf[0] != nil {
+		j.conf = *conf[0]
+	}
+	j.name = j.conf.Name
+	if j.name == "" {
+		j.name = runtime.FuncForPC(reflect.ValueOf(fun).Pointer()).Name()
+	}
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+// registerHooks starts the jobs once the server is listening and stops them
+// first when the application shuts down.
+func (s *scheduler) registerHooks(l *lifecycle) {
+	if len(s.jobs) == 0 {
+		return
+	}
+	l.register(LifecycleHook{
+		Name:  "scheduler",
+		Phase: OnReady,
+		Func: func(ctx context.Context) error {
+			s.start()
+			return nil
+		},
+	})
+	l.register(LifecycleHook{
+		Name:  "scheduler",
+		Phase: OnDrain,
+		Func:  s.stop,
+	})
+}
+
+func (s *scheduler) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func(j *job) {
+			defer s.wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+}
+
+// stop cancels the context of the running jobs and waits for them.
+func (s *scheduler) stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the jobs did not finish: %w", ctx.Err())
+	}
+}
+
+func (s *scheduler) loop(ctx context.Context, j *job) {
+	for {
+		next := j.schedule.next(time.Now())
+		if next.IsZero() {
+			globalApp.Logger().Errorf("[Freedom] The job '%s' has no next run, spec:%s", j.name, j.spec)
+			return
+		}
+		delay := time.Until(next)
+		if j.conf.Jitter > 0 {
+			delay += rand.N(j.conf.Jitter)
+		}
+		if !sleepContext(ctx, delay) {
+			return
+		}
+		s.trigger(ctx, j)
+	}
+}
+
+// trigger runs the job in the background, the run is skipped if the previous
+// run has not finished.
+func (s *scheduler) trigger(ctx context.Context, j *job) {
+	if j.conf.LeaderOnly && !globalApp.IsLeader() {
+		globalApp.Prometheus.JobWithLabelValues(j.name, jobFollower, time.Now())
+		return
+	}
+	if !j.conf.AllowOverlap && !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+		globalApp.Logger().Infof("[Freedom] The job '%s' is skipped, the previous run has not finished", j.name)
+		globalApp.Prometheus.JobWithLabelValues(j.name, jobSkipped, time.Now())
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if !j.conf.AllowOverlap {
+			defer atomic.StoreInt32(&j.running, 0)
+		}
+		s.run(ctx, j)
+	}()
+}
+
+// run calls the job with the service locator and returns when the job returns.
+// The context of the job expires at the timeout, a panic is recovered.
+func (s *scheduler) run(ctx context.Context, j *job) (result string, err error) {
+	start := time.Now()
+	if j.conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.conf.Timeout)
+		defer cancel()
+	}
+	//A leader only job stops when the leadership is lost
+	if j.conf.LeaderOnly {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(globalApp.lifecycle.leadership(), cancel)()
+	}
+
+	result = jobOK
+	func() {
+		defer func() {
+			if perr := recover(); perr != nil {
+				result, err = jobPanic, fmt.Errorf("panic: %v", perr)
+			}
+		}()
+		err = globalApp.serviceLocator.call(ctx, j.fun, func(work Worker) {
+			if token, ok := globalApp.fencingToken(); ok && j.conf.LeaderOnly {
+				work.Store().Set(FencingTokenKey, token)
+			}
+		})
+	}()
+
+	switch {
+	case result == jobPanic:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result = jobTimeout
+		globalApp.Logger().Errorf("[Freedom] The job '%s' timed out after %v", j.name, j.conf.Timeout)
+	case err != nil:
+		result = jobError
+	}
+	if err != nil {
+		globalApp.Logger().Errorf("[Freedom] The job '%s' failed, %v", j.name, err)
+	}
+	globalApp.Prometheus.JobWithLabelValues(j.name, result, start)
+	return
+}
+
+// sleepContext waits for d and returns false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	stdContext "context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -33,14 +34,34 @@ func (locator *ServiceLocatorImpl) InstallEndCallBack(f func(Worker)) {
 
 // Call Called with a service locator.
 func (locator *ServiceLocatorImpl) Call(fun interface{}) error {
+	return locator.call(stdContext.Background(), fun, nil)
+}
+
+// CallContext Called with a service locator, Worker.Context() is derived from ctx.
+// The Bus of the Worker is created from the optional header.
+func (locator *ServiceLocatorImpl) CallContext(ctx stdContext.Context, fun interface{}, header ...http.Header) error {
+	if len(header) == 0 || header[0] == nil {
+		return locator.call(ctx, fun, nil)
+	}
+	return locator.call(ctx, fun, func(work Worker) {
+		work.(*worker).bus = newBus(header[0])
+	})
+}
+
+// call calls fun with a Worker whose context is stdCtx, begin is called with
+// the Worker before the service is created.
+func (locator *ServiceLocatorImpl) call(stdCtx stdContext.Context, fun interface{}, begin func(Worker)) error {
 	ctx := context.NewContext(globalApp.IrisApp)
-	request := new(http.Request)
+	request := new(http.Request).WithContext(stdCtx)
 	request.URL = &url.URL{}
 	ctx.ResetRequest(request)
 
 	worker := newWorker(ctx)
 	ctx.Values().Set(WorkerKey, worker)
 	worker.bus = newBus(make(http.Header))
+	if begin != nil {
+		begin(worker)
+	}
 
 	serviceObj, err := parseCallServiceFunc(fun)
 	if err != nil {
@@ -12,6 +12,8 @@ import (
 func newServicePool() *servicePool {
 	result := new(servicePool)
 	result.pool = make(map[reflect.Type]*sync.Pool)
+	result.creater = make(map[reflect.Type]interface{})
+	result.lifetimes = make(map[reflect.Type]Lifetime)
 	return result
 }
 
@@ -19,12 +21,16 @@ func newServicePool() *servicePool {
 // pool key: the reflect.Type of domain service
 // pool value: *sync.Pool
 type servicePool struct {
-	pool map[reflect.Type]*sync.Pool
+	pool       map[reflect.Type]*sync.Pool
+	creater    map[reflect.Type]interface{}
+	lifetimes  map[reflect.Type]Lifetime
+	singletons singletons
 }
 
 type serviceElement struct {
 	workers       []reflect.Value
 	calls         []BeginRequest
+	transients    []func(Worker)
 	serviceObject interface{}
 }
 
@@ -75,6 +81,9 @@ func (pool *servicePool) freeHandle() context.Handler {
 // free .
 func (pool *servicePool) free(service interface{}) {
 	t := reflect.TypeOf(service.(serviceElement).serviceObject)
+	if pool.lifetimes[t] != PerRequest {
+		return
+	}
 	syncpool, ok := pool.pool[t]
 	if !ok {
 		return
@@ -83,9 +92,15 @@ func (pool *servicePool) free(service interface{}) {
 	syncpool.Put(service)
 }
 
-func (pool *servicePool) bind(t reflect.Type, f interface{}) {
+func (pool *servicePool) bind(t reflect.Type, f interface{}, lifetime Lifetime) {
+	pool.creater[t] = f
+	pool.lifetimes[t] = lifetime
 	pool.pool[t] = &sync.Pool{
 		New: func() interface{} {
+			if lifetime == Singleton {
+				return pool.singleton(t, f)
+			}
+
 			values := reflect.ValueOf(f).Call([]reflect.Value{})
 			if len(values) == 0 {
 				panic(fmt.Sprintf("[Freedom] BindService: func return to empty, %v", reflect.TypeOf(f)))
@@ -104,7 +119,7 @@ func (pool *servicePool) bind(t reflect.Type, f interface{}) {
 				globalApp.comPool.diInfraFromValue(fieldValue)
 				globalApp.factoryPool.diFactoryFromValue(fieldValue, &result)
 
-				if fieldValue.IsNil() {
+				if fieldValue.IsNil() || globalApp.lifetimeOfValue(fieldValue) != PerRequest {
 					return
 				}
 				if br, ok := fieldValue.Interface().(BeginRequest); ok {
@@ -120,6 +135,17 @@ func (pool *servicePool) bind(t reflect.Type, f interface{}) {
 	}
 }
 
+// singleton returns the element of the singleton service, it is shared by all the requests.
+func (pool *servicePool) singleton(t reflect.Type, f interface{}) serviceElement {
+	service, err := pool.singletons.get(t, func() (reflect.Value, error) {
+		return newSingleton(f, kindRepository, kindInfra, kindFactory)
+	})
+	if err != nil {
+		panic(fmt.Sprintf("[Freedom] BindService: %v", err))
+	}
+	return serviceElement{serviceObject: service.Interface()}
+}
+
 // malloc return a service object from pool or create a new service obj
 func (pool *servicePool) malloc(t reflect.Type) interface{} {
 	// 判断此 领域服务类型是否存在 pool
@@ -180,6 +206,9 @@ func (pool *servicePool) beginRequest(worker Worker, obj interface{}) {
 	for i := 0; i < len(instance.workers); i++ {
 		instance.workers[i].Set(workerValue)
 	}
+	for i := 0; i < len(instance.transients); i++ {
+		instance.transients[i](worker)
+	}
 	for i := 0; i < len(instance.calls); i++ {
 		instance.calls[i].BeginRequest(worker)
 	}
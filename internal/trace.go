@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"strings"
+)
+
+// The headers of the W3C Trace Context and Baggage.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+	BaggageHeader     = "baggage"
+)
+
+const (
+	traceparentVersion = "00"
+	// traceSampled is the sampled flag of the trace-flags.
+	traceSampled byte = 0x01
+)
+
+// TraceContext The W3C traceparent of a request.
+type TraceContext struct {
+	// TraceID is 32 lowercase hex characters.
+	TraceID string
+	// SpanID is the parent-id, 16 lowercase hex characters.
+	SpanID string
+	// Flags are the trace-flags.
+	Flags byte
+}
+
+// NewTraceContext Returns a sampled trace context with a new trace id.
+func NewTraceContext() TraceContext {
+	return TraceContext{TraceID: randomHex(16), SpanID: randomHex(8), Flags: traceSampled}
+}
+
+// NewTraceContextWithID Returns a sampled trace context of the trace id, it is
+// a new trace if traceID is not 32 lowercase hex characters.
+func NewTraceContextWithID(traceID string) TraceContext {
+	if !validHex(traceID, 32) {
+		return NewTraceContext()
+	}
+	return TraceContext{TraceID: traceID, SpanID: randomHex(8), Flags: traceSampled}
+}
+
+// ParseTraceparent Parses the value of the traceparent header.
+func ParseTraceparent(value string) (tc TraceContext, ok bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 {
+		return
+	}
+	version := value[0:2]
+	if !validHex(version, 2) || version == "ff" {
+		return
+	}
+	//The future versions may append fields after the flags
+	if version == traceparentVersion && len(value) != 55 || len(value) > 55 && value[55] != '-' {
+		return
+	}
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return
+	}
+	traceID, spanID, flags := value[3:35], value[36:52], value[53:55]
+	if !validHex(traceID, 32) || !validHex(spanID, 16) || !validHex(flags, 2) {
+		return
+	}
+	flag, _ := hex.DecodeString(flags)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: flag[0]}, true
+}
+
+// Sampled Reports whether the caller may have recorded the trace.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&traceSampled == traceSampled
+}
+
+// Child Returns the trace context of a new span in the same trace.
+func (tc TraceContext) Child() TraceContext {
+	tc.SpanID = randomHex(8)
+	return tc
+}
+
+// String Returns the value of the traceparent header.
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// validHex reports whether s is n lowercase hex characters and not all zeros.
+func validHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	zero := true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+		if c != '0' {
+			zero = false
+		}
+	}
+	return !zero || n == 2
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		for i := range b {
+			b[i] = byte(rand.Uint32())
+		}
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+// TraceContext Returns the trace context of the request.
+func (b *Bus) TraceContext() (TraceContext, bool) {
+	return ParseTraceparent(b.Get(TraceparentHeader))
+}
+
+// SetTraceContext Sets the trace context of the request.
+func (b *Bus) SetTraceContext(tc TraceContext) {
+	b.Set(TraceparentHeader, tc.String())
+}
+
+// baggageMember is a list-member of the baggage header, the properties are kept as they are.
+type baggageMember struct {
+	key        string
+	value      string
+	properties string
+}
+
+func (b *Bus) baggage() (members []baggageMember) {
+	for _, header := range b.Values(BaggageHeader) {
+		for _, item := range strings.Split(header, ",") {
+			member, properties, _ := strings.Cut(item, ";")
+			key, value, ok := strings.Cut(member, "=")
+			key = strings.TrimSpace(key)
+			if !ok || key == "" {
+				continue
+			}
+			if decoded, err := url.PathUnescape(strings.TrimSpace(value)); err == nil {
+				value = decoded
+			}
+			members = append(members, baggageMember{key: key, value: value, properties: strings.TrimSpace(properties)})
+		}
+	}
+	return
+}
+
+func (b *Bus) setBaggage(members []baggageMember) {
+	if len(members) == 0 {
+		b.Del(BaggageHeader)
+		return
+	}
+	items := make([]string, 0, len(members))
+	for _, member := range members {
+		item := member.key + "=" + url.PathEscape(member.value)
+		if member.properties != "" {
+			item += ";" + member.properties
+		}
+		items = append(items, item)
+	}
+	b.Set(BaggageHeader, strings.Join(items, ","))
+}
+
+// BaggageItem Returns the value of the baggage item, the value is decoded.
+func (b *Bus) BaggageItem(key string) string {
+	for _, member := range b.baggage() {
+		if member.key == key {
+			return member.value
+		}
+	}
+	return ""
+}
+
+// BaggageItems Returns all the baggage items.
+func (b *Bus) BaggageItems() map[string]string {
+	result := make(map[string]string)
+	for _, member := range b.baggage() {
+		if _, ok := result[member.key]; !ok {
+			result[member.key] = member.value
+		}
+	}
+	return result
+}
+
+// SetBaggageItem Sets the baggage item, it is sent with the bus to the downstream services.
+func (b *Bus) SetBaggageItem(key, value string) {
+	members := b.baggage()
+	for i := range members {
+		if members[i].key == key {
+			members[i].value = value
+			b.setBaggage(members)
+			return
+		}
+	}
+	b.setBaggage(append(members, baggageMember{key: key, value: value}))
+}
+
+// DelBaggageItem Deletes the baggage item.
+func (b *Bus) DelBaggageItem(key string) {
+	members := b.baggage()
+	result := members[:0]
+	for _, member := range members {
+		if member.key != key {
+			result = append(result, member)
+		}
+	}
+	b.setBaggage(result)
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -17,6 +18,7 @@ type UnitTest interface {
 	FetchRepository(repository interface{})
 	FetchFactory(factory interface{})
 	InstallDB(f func() (db interface{}))
+	InstallNamedDB(name string, f func() (db interface{}))
 	InstallRedis(f func() (client redis.Cmdable))
 	InstallCustom(f func() interface{})
 	Run()
@@ -41,35 +43,47 @@ func (u *UnitTestImpl) FetchService(service interface{}) {
 
 // FetchRepository .
 func (u *UnitTestImpl) FetchRepository(repository interface{}) {
+	if err := u.fetchRepository(reflect.ValueOf(repository).Elem()); err != nil {
+		globalApp.IrisApp.Logger().Fatal(err)
+	}
+}
+
+// FetchFactory .
+func (u *UnitTestImpl) FetchFactory(factory interface{}) {
+	if err := u.fetchFactory(reflect.ValueOf(factory).Elem()); err != nil {
+		globalApp.IrisApp.Logger().Fatal(err)
+	}
+}
+
+func (u *UnitTestImpl) fetchRepository(value reflect.Value) error {
 	instance := serviceElement{calls: []BeginRequest{}, workers: []reflect.Value{}}
-	value := reflect.ValueOf(repository).Elem()
+	if !value.CanSet() {
+		return fmt.Errorf("[Freedom] This use repository object must be a capital variable, %v", value.Type().String())
+	}
 	ok := globalApp.rpool.diRepoFromValue(value, &instance)
 	if !ok {
-		globalApp.IrisApp.Logger().Fatalf("[Freedom] No dependency injection was found for the object,%v", value.Type().String())
-	}
-	if !value.CanSet() {
-		globalApp.IrisApp.Logger().Fatalf("[Freedom] This use repository object must be a capital variable, %v" + value.Type().String())
+		return fmt.Errorf("[Freedom] No dependency injection was found for the object,%v", value.Type().String())
 	}
 
 	if br, ok := value.Interface().(BeginRequest); ok {
 		instance.calls = append(instance.calls, br)
 	}
 	globalApp.pool.beginRequest(u.rt, instance)
+	return nil
 }
 
-// FetchFactory .
-func (u *UnitTestImpl) FetchFactory(factory interface{}) {
+func (u *UnitTestImpl) fetchFactory(value reflect.Value) error {
 	instance := serviceElement{calls: []BeginRequest{}, workers: []reflect.Value{}}
-	value := reflect.ValueOf(factory).Elem()
+	if !value.CanSet() {
+		return fmt.Errorf("[Freedom] This use factory object must be a capital variable, %v", value.Type().String())
+	}
 	ok := globalApp.factoryPool.diFactoryFromValue(value, &instance)
 	if !ok {
-		globalApp.IrisApp.Logger().Fatalf("[Freedom] No dependency injection was found for the object,%v", value.Type().String())
-	}
-	if !value.CanSet() {
-		globalApp.IrisApp.Logger().Fatalf("[Freedom] This use repository object must be a capital variable, %v" + value.Type().String())
+		return fmt.Errorf("[Freedom] No dependency injection was found for the object,%v", value.Type().String())
 	}
 
 	globalApp.pool.beginRequest(u.rt, instance)
+	return nil
 }
 
 // InstallDB .
@@ -77,6 +91,11 @@ func (u *UnitTestImpl) InstallDB(f func() (db interface{})) {
 	globalApp.InstallDB(f)
 }
 
+// InstallNamedDB .
+func (u *UnitTestImpl) InstallNamedDB(name string, f func() (db interface{})) {
+	globalApp.InstallNamedDB(name, f)
+}
+
 // InstallRedis .
 func (u *UnitTestImpl) InstallRedis(f func() (client redis.Cmdable)) {
 	globalApp.InstallRedis(f)
@@ -3,7 +3,11 @@ package internal
 import (
 	stdContext "context"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/8treenet/iris/v12"
@@ -46,7 +50,8 @@ type Worker interface {
 	// Returns an address to current Bus.
 	Bus() *Bus
 
-	// Returns current context.
+	// Returns current context. It expires at the deadline sent by the caller
+	// in DeadlineHeader.
 	Context() stdContext.Context
 
 	// Set current context instead Context.
@@ -72,6 +77,11 @@ type Worker interface {
 	// the http handler goroutine to respond to the client. Once this opportunity
 	// was met, the client will got an "Internal Server Error" or other wrong
 	// result, because resource has been recycled by GC before to respond to client.
+	//
+	// After the server stops, the shutdown waits for the Worker until
+	// freedom.Recycle is called, at most recycle_second.
+	// Prefer freedom.Go or freedom.Detach for the goroutines spawned from a
+	// request, they do not share the resource with the request.
 	DeferRecycle()
 
 	// Indicates system need to wait a while for recycle resource.
@@ -84,12 +94,25 @@ type Worker interface {
 func newWorkerHandle() context.Handler {
 	return func(ctx context.Context) {
 		work := newWorker(ctx)
+		work.tracked = true
+		globalApp.inflight.add()
+		defer func() {
+			//A DeferRecycle Worker is waited until Recycle is called, not by the server
+			if work.IsDeferRecycle() {
+				work.endRequest()
+				return
+			}
+			globalApp.inflight.done()
+		}()
 		ctx.Values().Set(WorkerKey, work)
 		ctx.Next()
 
 		if work.IsDeferRecycle() {
 			return
 		}
+		if work.cancel != nil {
+			work.cancel()
+		}
 		work.logger = nil
 		work.ctx = nil
 		ctx.Values().Reset()
@@ -107,6 +130,14 @@ func newWorker(ctx iris.Context) *worker {
 	work.stdCtx = ctx.Request().Context()
 	work.time = time.Now()
 	work.deferRecycle = false
+	//The budget is sent again with the remaining time by the outgoing requests
+	if deadline, ok := ParseDeadline(work.bus.Get(DeadlineHeader), work.time); ok {
+		work.stdCtx, work.cancel = stdContext.WithDeadline(work.stdCtx, deadline)
+		ctx.ResetRequest(ctx.Request().WithContext(work.stdCtx))
+	}
+	work.bus.Del(DeadlineHeader)
+	//The request is kept for Detach after the context is recycled
+	work.request = ctx.Request()
 	HandleBusMiddleware(work)
 	return work
 }
@@ -114,6 +145,7 @@ func newWorker(ctx iris.Context) *worker {
 // worker act as a default implementation to Worker.
 type worker struct {
 	ctx          iris.Context
+	request      *http.Request
 	freeServices []interface{}
 	freeComs     []interface{}
 	logger       Logger
@@ -122,6 +154,11 @@ type worker struct {
 	time         time.Time
 	values       memstore.Store
 	deferRecycle bool
+	recycled     bool
+	tracked      bool
+	ended        bool
+	recycleMu    sync.Mutex
+	cancel       stdContext.CancelFunc
 	randInstance *rand.Rand
 }
 
@@ -164,6 +201,130 @@ func (rt *worker) IsDeferRecycle() bool {
 	return rt.deferRecycle
 }
 
+// Recycle ends a Worker marked by DeferRecycle, call it when the goroutines
+// that use the Worker have finished. The resource is recycled and the shutdown
+// of the application no longer waits for the Worker.
+func Recycle(w Worker) {
+	if rt, ok := w.(*worker); ok {
+		rt.recycle()
+	}
+}
+
+// recycle ends a Worker marked by DeferRecycle or a Worker of Go, the resource
+// is recycled and the shutdown of the application no longer waits for the Worker.
+func (rt *worker) recycle() {
+	rt.recycleMu.Lock()
+	defer rt.recycleMu.Unlock()
+	if !rt.deferRecycle || rt.recycled {
+		return
+	}
+	rt.recycled = true
+	for _, service := range rt.freeServices {
+		globalApp.pool.free(service)
+	}
+	for _, com := range rt.freeComs {
+		globalApp.comPool.free(com)
+	}
+	rt.freeServices = nil
+	rt.freeComs = nil
+	if rt.cancel != nil {
+		rt.cancel()
+	}
+	if !rt.tracked {
+		return
+	}
+	if rt.ended {
+		globalApp.inflight.deferredDone()
+		return
+	}
+	globalApp.inflight.done()
+}
+
+// endRequest hands a DeferRecycle Worker over to the deferred workers when its
+// request ends, unless it has been recycled already.
+func (rt *worker) endRequest() {
+	rt.recycleMu.Lock()
+	defer rt.recycleMu.Unlock()
+	if rt.recycled {
+		return
+	}
+	rt.ended = true
+	globalApp.inflight.deferRecycle()
+}
+
+// Detach returns a background Worker for the work that outlives the request.
+// The bus, the logger and the store are cloned, the transaction handles are
+// not. Its context keeps the values of the request context but it is not
+// canceled with the request, it is canceled when the application has shut
+// down. The shutdown does not wait for the Worker, use Go for that.
+// It can be called after the request has ended.
+func Detach(w Worker) Worker {
+	stdCtx := detachedContext{Context: globalApp.background, values: stdContext.WithoutCancel(w.Context())}
+
+	request := new(http.Request)
+	if rt, ok := w.(*worker); ok && rt.request != nil {
+		request = rt.request
+	}
+	request = request.Clone(stdCtx)
+	if request.URL == nil {
+		request.URL = &url.URL{}
+	}
+	request.Body = http.NoBody
+	ctx := context.NewContext(globalApp.IrisApp)
+	ctx.ResetRequest(request)
+
+	work := new(worker)
+	work.freeServices = make([]interface{}, 0)
+	work.freeComs = make([]interface{}, 0)
+	work.ctx = ctx
+	work.request = request
+	work.bus = newBus(w.Bus().Header)
+	work.logger = w.Logger()
+	work.stdCtx = stdCtx
+	work.time = time.Now()
+	work.deferRecycle = true
+	w.Store().Visit(func(key string, value interface{}) {
+		//事务句柄随请求结束
+		if strings.HasPrefix(key, TransactionKey) {
+			return
+		}
+		work.values.Set(key, value)
+	})
+	ctx.Values().Set(WorkerKey, work)
+	return work
+}
+
+// Go runs f in a goroutine with a detached Worker which is recycled when f
+// returns. The shutdown waits for f, a panic is recovered and logged by the
+// Worker logger.
+func Go(w Worker, f func(Worker)) {
+	work := Detach(w).(*worker)
+	work.stdCtx, work.cancel = stdContext.WithCancel(work.stdCtx)
+	work.tracked = true
+	globalApp.inflight.add()
+	go func() {
+		defer work.recycle()
+		defer func() {
+			if err := recover(); err != nil {
+				work.Logger().Errorf("[Freedom] A panic was recovered in the background worker, %v", err)
+			}
+		}()
+		f(work)
+	}()
+}
+
+// detachedContext is canceled with the application, the values are looked up
+// in the context of the request. Nothing is registered on the application
+// context, a detached Worker is released by the garbage collector.
+type detachedContext struct {
+	stdContext.Context
+	values stdContext.Context
+}
+
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.values.Value(key)
+}
+
 func (rt *worker) Rand() *rand.Rand {
 	if rt.randInstance == nil {
 		rt.randInstance = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -6,7 +6,14 @@ import (
 	"github.com/8treenet/freedom"
 )
 
+var traceHeaders = map[string]bool{
+	freedom.TraceparentHeader: true,
+	freedom.TracestateHeader:  true,
+	freedom.BaggageHeader:     true,
+}
+
 // NewBusFilter Worker's middleware, filtering HTTP Header.
+// The headers of the W3C Trace Context and Baggage are kept.
 func NewBusFilter() func(freedom.Worker) {
 	return func(run freedom.Worker) {
 		bus := run.Bus()
@@ -14,6 +21,9 @@ func NewBusFilter() func(freedom.Worker) {
 			if strings.Index(key, "x-") == 0 || strings.Index(key, "X-") == 0 {
 				continue
 			}
+			if traceHeaders[strings.ToLower(key)] {
+				continue
+			}
 			bus.Del(key)
 		}
 	}
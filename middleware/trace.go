@@ -16,21 +16,25 @@ func init() {
 }
 
 // NewTrace The default HTTP Trace.
+// The W3C traceparent of the caller is continued with a new span id, a new trace
+// is started if there is none. traceIDName is set to the trace id if the caller
+// did not send it, a valid id sent under traceIDName is used to start the trace.
+// The outgoing requests and kafka messages send the traceparent with a new span id.
 func NewTrace(traceIDName string) func(context.Context) {
 	return func(ctx context.Context) {
 		bus := freedom.ToWorker(ctx).Bus()
 		traceID := bus.Get(traceIDName)
-		for {
-			if traceID != "" {
-				break
-			}
 
-			var e error
-			if traceID, e = GenerateTraceID(); e != nil {
-				break
-			}
-			bus.Add(traceIDName, traceID)
-			break
+		tc, ok := bus.TraceContext()
+		if ok {
+			tc = tc.Child()
+		} else {
+			bus.Del(freedom.TracestateHeader)
+			tc = freedom.NewTraceContextWithID(traceID)
+		}
+		bus.SetTraceContext(tc)
+		if traceID == "" {
+			bus.Add(traceIDName, tc.TraceID)
 		}
 		ctx.Next()
 	}